@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Version of the backup format, increased whenever it changes in a breaking way
+const BackupVersion = 1
+
+// Contents of a backup file
+type Backup struct {
+	Version     int              `json:"version"`
+	Created     time.Time        `json:"created"`
+	Settings    BackupSettings   `json:"settings"`
+	Items       []Item           `json:"items"`
+	ExternalIds []BackupExternal `json:"external_ids"`
+	Comments    []Comment        `json:"comments"`
+}
+
+// Settings saved in a backup, the database password is never included
+type BackupSettings struct {
+	Username string `json:"username"`
+	Backend  string `json:"backend,omitempty"`
+	UseDb    bool   `json:"use_db"`
+	DbHost   string `json:"db_host,omitempty"`
+	DbPort   int    `json:"db_port,omitempty"`
+	DbUser   string `json:"db_user,omitempty"`
+	DbName   string `json:"db_name,omitempty"`
+}
+
+// An id from another program mapped to an item in the backup
+type BackupExternal struct {
+	Source     string `json:"source"`
+	ExternalId string `json:"external_id"`
+	ItemId     int    `json:"item_id"`
+}
+
+// Function to back up all items (including finished ones) and settings to a file
+func backupItems(store Store, settings Settings) error {
+	if len(os.Args) != 3 {
+		return invalidInput("Usage: wtodo backup <file>")
+	}
+
+	// Only the user's own items are backed up, items of others in shared lists are theirs to back up
+	all, err := store.SelectAll(true)
+	if err != nil {
+		return err
+	}
+	var items []Item
+	for _, it := range all {
+		if !sharedStore(store) || it.Owner == settings.Username {
+			items = append(items, it)
+		}
+	}
+	backup := Backup{
+		Version: BackupVersion,
+		Created: time.Now(),
+		Settings: BackupSettings{
+			Username: settings.Username,
+			Backend:  settings.Backend,
+			UseDb:    settings.Backend == PostgresBackend,
+			DbHost:   settings.Database.Host,
+			DbPort:   settings.Database.Port,
+			DbUser:   settings.Database.User,
+			DbName:   settings.Database.Name,
+		},
+		Items: items,
+	}
+
+	// Save the ids from other programs so they still match after restoring
+	backedUp := make(map[int]bool)
+	for _, it := range items {
+		backedUp[it.Id] = true
+	}
+	for _, source := range []string{TaskwarriorSource} {
+		ids, err := store.SelectExternalIds(source)
+		if err != nil {
+			return err
+		}
+		for id, externalId := range ids {
+			if !backedUp[id] {
+				continue
+			}
+			backup.ExternalIds = append(backup.ExternalIds, BackupExternal{source, externalId, id})
+		}
+	}
+	sort.Slice(backup.ExternalIds, func(p, q int) bool {
+		return backup.ExternalIds[p].ItemId < backup.ExternalIds[q].ItemId
+	})
+
+	// Save the comments on every item
+	for _, it := range backup.Items {
+		comments, err := store.SelectComments(it.Id)
+		if err != nil {
+			return err
+		}
+		backup.Comments = append(backup.Comments, comments...)
+	}
+
+	out, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error creating backup: %w", err)
+	}
+	err = writeOutput(os.Args[2], append(out, '\n'))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sBacked up %d items to %s%s\n", LIGHT_GREEN_C, len(backup.Items), os.Args[2], RESET_C)
+	return nil
+}
+
+// Function to restore items from a backup file into the current store
+func restoreItems(store Store, settings *Settings) error {
+	usageInfo := "Usage: wtodo restore [-replace | -merge] [-settings] <file>"
+
+	var replace, merge, restoreSettings bool
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreFlags.BoolVar(&replace, "replace", false, "Replace your current items with the backed up ones")
+	restoreFlags.BoolVar(&merge, "merge", false, "Add the backed up items to the current items")
+	restoreFlags.BoolVar(&restoreSettings, "settings", false, "Also restore the username from the backup")
+	restoreFlags.Parse(os.Args[2:])
+	if restoreFlags.NArg() != 1 || (replace && merge) {
+		return invalidInput(usageInfo)
+	}
+
+	// Load and check the backup before changing anything
+	content, err := readInput(restoreFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var backup Backup
+	err = json.Unmarshal(content, &backup)
+	if err != nil {
+		return invalidInput("Invalid backup file: %s", err)
+	}
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return invalidInput("Unsupported backup version %d, this version of wtodo reads up to version %d", backup.Version, BackupVersion)
+	}
+
+	// Skip items of other users, which backups of shared lists made by older versions included
+	var items []Item
+	for _, it := range backup.Items {
+		if it.Length < ShortTask || it.Length > LongTask {
+			return invalidInput("Invalid backup file: item %d has unknown length %d", it.Id, it.Length)
+		}
+		if it.Owner == "" || it.Owner == backup.Settings.Username {
+			items = append(items, it)
+		}
+	}
+
+	// Don't mix the backup into existing items unless asked to
+	// Only the user's own items count, items of others in shared lists are never replaced
+	current, err := store.SelectAll(true)
+	if err != nil {
+		return err
+	}
+	var mine []Item
+	for _, it := range current {
+		if !sharedStore(store) || it.Owner == settings.Username {
+			mine = append(mine, it)
+		}
+	}
+	if len(mine) > 0 && !replace && !merge {
+		return &ConflictError{Msg: fmt.Sprintf("There are already %d items, use -replace to delete them or -merge to keep them", len(mine))}
+	}
+
+	// Check every item can be added before changing anything
+	if checker, ok := store.(listChecker); ok {
+		for _, it := range items {
+			err = checker.checkList(it.List, "add items to it")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Items replacing their own copies update them in place, the others are inserted as new items
+	// Items merged in next to their own copies get new UUIDs, as they are separate items now
+	uuids := make(map[string]bool)
+	for _, it := range current {
+		uuids[it.Uuid] = true
+	}
+	replaced := make(map[string]int)
+	if replace {
+		for _, it := range mine {
+			replaced[it.Uuid] = it.Id
+		}
+	}
+	ids := make(map[int]int)
+	kept := make(map[int]bool)
+	for _, it := range items {
+		if id, ok := replaced[it.Uuid]; ok {
+			delete(replaced, it.Uuid)
+			ids[it.Id] = id
+			kept[id] = true
+			it.Id = id
+			err = store.UpdateItem(it)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if uuids[it.Uuid] {
+			it.Uuid = ""
+		}
+		err = restoreItem(store, it, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only delete the replaced items that aren't in the backup once everything else is restored
+	if replace {
+		for _, it := range mine {
+			if !kept[it.Id] {
+				err = store.DeleteItem(it.Id)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Items updated in place still have their comments, so only the missing ones are added
+	seen := make(map[string]bool)
+	for id := range kept {
+		comments, err := store.SelectComments(id)
+		if err != nil {
+			return err
+		}
+		for _, c := range comments {
+			seen[commentKey(c)] = true
+		}
+	}
+
+	// Point the external ids and comments at the new ids, skipping ones for items not in the backup
+	for _, ext := range backup.ExternalIds {
+		if id, ok := ids[ext.ItemId]; ok {
+			err = store.InsertExternalId(ext.Source, ext.ExternalId, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range backup.Comments {
+		if id, ok := ids[c.ItemId]; ok {
+			c.ItemId = id
+			if seen[commentKey(c)] {
+				continue
+			}
+			err = store.RestoreComment(c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if restoreSettings && backup.Settings.Username != "" {
+		settings.Username = backup.Settings.Username
+		err = savePrefs(settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%sRestored %d items from backup made %s%s\n", LIGHT_GREEN_C, len(items), backup.Created.Format("Mon 1/2/06 3:04pm"), RESET_C)
+	return nil
+}
+
+// Stores shared by several users, which only let users add items to the lists they can edit
+type listChecker interface {
+	checkList(name string, action string) error
+}
+
+// Helper function to check if a store can hold items of other users
+func sharedStore(store Store) bool {
+	if _, ok := store.(listChecker); ok {
+		return true
+	}
+	_, offline := store.(*offlineStore)
+	return offline
+}
+
+// Helper function to insert an item from a backup as a new item, remembering its new id
+func restoreItem(store Store, it Item, ids map[int]int) error {
+	oldId := it.Id
+	it.Id = 0
+	id, err := store.InsertItem(it)
+	if err != nil {
+		return err
+	}
+	ids[oldId] = id
+	return nil
+}
+
+// Helper function to tell comments apart by their item, author, time and text, as their ids change
+func commentKey(c Comment) string {
+	return fmt.Sprintf("%d %s %d %s", c.ItemId, c.Author, c.Created.Unix(), c.Body)
+}
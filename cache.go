@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"time"
+)
+
+// A change made while the database couldn't be reached, replayed on the next connection
+// Base is when the item was last updated on the database before it was changed offline,
+// used to find changes made by someone else in the meantime
+type JournalEntry struct {
+	Op         string    `json:"op"`
+	Id         int       `json:"id"`
+	Base       time.Time `json:"base"`
+	Item       *Item     `json:"item,omitempty"`
+	Comment    *Comment  `json:"comment,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	ExternalId string    `json:"external_id,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Store backed by the database that keeps a local copy of the items to use when offline
+type cachedStore struct {
+	*dbStore
+	cachePath string
+}
+
+// Store used when the database can't be reached, reading from the local copy
+// and saving changes to a journal to replay later
+type offlineStore struct {
+	*fileStore
+	journalPath string
+	journal     []JournalEntry
+}
+
+// Helper function to get the path of the cache (and journal) for the database in the settings
+func getCachePath(settings Settings) string {
+	dir := getDataDir() + "/cache"
+	os.Mkdir(dir, fs.FileMode(0700))
+	return dir + "/" + storeKey(settings) + ".json"
+}
+
+// Helper function to name files kept for the database in the settings
+func storeKey(settings Settings) string {
+	name := fmt.Sprintf("%s@%s_%d_%s", settings.Username, settings.Database.Host, settings.Database.Port, settings.Database.Name)
+	return regexp.MustCompile(`[^A-Za-z0-9@._-]`).ReplaceAllString(name, "_")
+}
+
+// Opens the database in the settings, replaying changes made offline,
+// or the local copy of the items if the database can't be reached
+func openCachedStore(settings Settings) (Store, error) {
+	cachePath := getCachePath(settings)
+	journalPath := cachePath[:len(cachePath)-len(".json")] + ".journal.json"
+
+	// Only work offline when the server can't be reached, a wrong password or database name needs fixing instead
+	db, err := openDb(settings)
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) && unavailable.Unreachable {
+		fmt.Fprintf(os.Stderr, "%s%s\nWorking offline with the items saved on %s, changes will be sent the next time the database can be reached%s\n", GREY_C, err, cacheTime(cachePath), RESET_C)
+		cache, err := openFileStore(cachePath, settings.Username)
+		if err != nil {
+			return nil, err
+		}
+		journal, err := loadJournal(journalPath)
+		if err != nil {
+			return nil, err
+		}
+		return &offlineStore{fileStore: cache, journalPath: journalPath, journal: journal}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Make sure tables added in newer versions exist
+	err = createTables(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	connStr, err := connString(settings)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &cachedStore{
+		dbStore:   &dbStore{db: db, owner: settings.Username, connStr: connStr},
+		cachePath: cachePath,
+	}
+	err = s.replay(journalPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Saves a copy of all items and comments the user can see before closing the database
+func (s *cachedStore) Close() {
+	err := s.saveCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sCould not save the items for working offline: %s%s\n", GREY_C, err, RESET_C)
+	}
+	s.dbStore.Close()
+}
+
+// Helper function to save a copy of everything the user can see to the cache
+// This runs on every close, so it only uses a few queries however many items there are
+func (s *cachedStore) saveCache() error {
+	cache := fileStore{path: s.cachePath, user: s.owner}
+	items, err := s.SelectAll(true)
+	if err != nil {
+		return err
+	}
+	cache.data.Items = items
+	for _, it := range items {
+		if it.Id > cache.data.NextId {
+			cache.data.NextId = it.Id
+		}
+	}
+	cache.data.Comments, err = selectVisibleComments(s.db, s.owner)
+	if err != nil {
+		return err
+	}
+	for _, c := range cache.data.Comments {
+		if c.Id > cache.data.NextComment {
+			cache.data.NextComment = c.Id
+		}
+	}
+	ids, err := s.SelectExternalIds(TaskwarriorSource)
+	if err != nil {
+		return err
+	}
+	cache.data.ExternalIds = map[string]map[string]int{TaskwarriorSource: {}}
+	for id, externalId := range ids {
+		cache.data.ExternalIds[TaskwarriorSource][externalId] = id
+	}
+	return cache.save()
+}
+
+// Sends the changes made offline to the database, skipping ones that conflict with changes made there since
+func (s *cachedStore) replay(journalPath string) error {
+	journal, err := loadJournal(journalPath)
+	if err != nil || len(journal) == 0 {
+		return err
+	}
+
+	// Items added offline get new ids from the database
+	ids := make(map[int]int)
+	replayed := make(map[int]bool)
+	applied := 0
+	var rejected []JournalEntry
+	for _, e := range journal {
+		id, added := ids[e.Id]
+		if !added {
+			id = e.Id
+		}
+
+		// Only the first change to an item needs to be checked, the rest build on it
+		if e.Op != "insert" && !added && !replayed[id] {
+			err := s.checkConflict(e, id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%sConflict, not applying offline change to %s: %s%s\n", RED_C, describeEntry(e), err, RESET_C)
+				rejected = append(rejected, e)
+				continue
+			}
+		}
+
+		var err error
+		switch e.Op {
+		case "insert":
+			ids[e.Id], err = s.InsertItem(*e.Item)
+			replayed[ids[e.Id]] = true
+		case "update":
+			e.Item.Id = id
+			err = s.UpdateItem(*e.Item)
+		case "finish":
+			err = s.FinishItem(id)
+		case "delete":
+			err = s.DeleteItem(id)
+		case "comment":
+			e.Comment.ItemId = id
+			err = s.AddComment(*e.Comment)
+		case "restore-comment":
+			e.Comment.ItemId = id
+			err = s.RestoreComment(*e.Comment)
+		case "external":
+			err = s.InsertExternalId(e.Source, e.ExternalId, id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sNot applying offline change to %s: %s%s\n", RED_C, describeEntry(e), err, RESET_C)
+			rejected = append(rejected, e)
+			continue
+		}
+		replayed[id] = true
+		applied++
+	}
+
+	fmt.Fprintf(os.Stderr, "%sSent %d of %d changes made offline to the database%s\n", GREY_C, applied, len(journal), RESET_C)
+
+	// Keep the changes that weren't sent, so they can be looked at and made again by hand
+	if len(rejected) > 0 {
+		rejectedPath := journalPath[:len(journalPath)-len(".journal.json")] + ".rejected.json"
+		err = saveRejected(rejectedPath, rejected)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%sThe %d changes that weren't sent are kept in %s%s\n", GREY_C, len(rejected), rejectedPath, RESET_C)
+	}
+	err = os.Remove(journalPath)
+	if err != nil {
+		return fmt.Errorf("Could not clear the offline journal: %w", err)
+	}
+	return nil
+}
+
+// Helper function to check if an item was changed or deleted on the database after it was changed offline
+func (s *cachedStore) checkConflict(e JournalEntry, id int) error {
+	current, err := s.SelectItem(id)
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		return errors.New("it was deleted on the database")
+	} else if err != nil {
+		return err
+	}
+	if !e.Base.IsZero() && !current.Updated.Equal(e.Base) {
+		return fmt.Errorf("it was changed on the database at %s", current.Updated.Local().Format("Mon 1/2/06 3:04pm"))
+	}
+	return nil
+}
+
+// Helper function to describe the item a journal entry changes
+func describeEntry(e JournalEntry) string {
+	if e.Item != nil {
+		return fmt.Sprintf("%s item %d (%s)", e.Op, e.Id, e.Item.Name)
+	}
+	return fmt.Sprintf("%s item %d", e.Op, e.Id)
+}
+
+// Helper function to get when the cache was last saved
+func cacheTime(cachePath string) string {
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		return "(never, no items are saved)"
+	}
+	return info.ModTime().Format("Mon 1/2/06 3:04pm")
+}
+
+// Loads the changes made offline, empty if there are none
+func loadJournal(path string) ([]JournalEntry, error) {
+	var journal []JournalEntry
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return journal, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not open the offline journal: %w", err)
+	}
+	err = json.Unmarshal(content, &journal)
+	if err != nil {
+		return nil, fmt.Errorf("Offline journal is corrupted: %w", err)
+	}
+	return journal, nil
+}
+
+// Adds changes that couldn't be replayed to the ones rejected before
+func saveRejected(path string, entries []JournalEntry) error {
+	rejected, err := loadJournal(path)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(append(rejected, entries...), "", "  ")
+	if err == nil {
+		err = writeDataFile(path, content)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save the rejected offline changes: %w", err)
+	}
+	return nil
+}
+
+// Adds a change to the journal, using the same base as earlier changes to the item
+func (s *offlineStore) record(e JournalEntry) error {
+	e.Time = time.Now()
+	for _, prev := range s.journal {
+		if prev.Id == e.Id {
+			e.Base = prev.Base
+			break
+		}
+	}
+	s.journal = append(s.journal, e)
+
+	content, err := json.MarshalIndent(s.journal, "", "  ")
+	if err == nil {
+		err = writeDataFile(s.journalPath, content)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save the offline journal: %w", err)
+	}
+	return nil
+}
+
+func (s *offlineStore) InsertItem(item Item) (int, error) {
+	// The UUID is given here so the item keeps it when it is sent to the database
+	if item.Uuid == "" {
+		var err error
+		item.Uuid, err = newUUID()
+		if err != nil {
+			return 0, err
+		}
+	}
+	id, err := s.fileStore.InsertItem(item)
+	if err != nil {
+		return id, err
+	}
+	return id, s.record(JournalEntry{Op: "insert", Id: id, Item: &item})
+}
+
+func (s *offlineStore) UpdateItem(item Item) error {
+	base, err := s.fileStore.SelectItem(item.Id)
+	if err == nil {
+		err = s.fileStore.UpdateItem(item)
+	}
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "update", Id: item.Id, Base: base.Updated, Item: &item})
+}
+
+func (s *offlineStore) FinishItem(id int) error {
+	base, err := s.fileStore.SelectItem(id)
+	if err == nil {
+		err = s.fileStore.FinishItem(id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "finish", Id: id, Base: base.Updated, Item: &base})
+}
+
+func (s *offlineStore) DeleteItem(id int) error {
+	base, err := s.fileStore.SelectItem(id)
+	if err == nil {
+		err = s.fileStore.DeleteItem(id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "delete", Id: id, Base: base.Updated, Item: &base})
+}
+
+func (s *offlineStore) AddComment(c Comment) error {
+	err := s.fileStore.AddComment(c)
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "comment", Id: c.ItemId, Comment: &c})
+}
+
+func (s *offlineStore) RestoreComment(c Comment) error {
+	err := s.fileStore.RestoreComment(c)
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "restore-comment", Id: c.ItemId, Comment: &c})
+}
+
+func (s *offlineStore) InsertExternalId(source string, externalId string, id int) error {
+	err := s.fileStore.InsertExternalId(source, externalId, id)
+	if err != nil {
+		return err
+	}
+	return s.record(JournalEntry{Op: "external", Id: id, Source: source, ExternalId: externalId})
+}
+
+// Users and lists can only be changed while connected to the database
+var errOffline = &UnavailableError{Err: errors.New("the database can't be reached, users and lists can only be changed while online")}
+
+func (s *offlineStore) RenameUser(newName string) error {
+	return errOffline
+}
+
+func (s *offlineStore) ClaimItems() (int, error) {
+	return 0, errOffline
+}
+
+func (s *offlineStore) CreateList(name string) error {
+	return errOffline
+}
+
+func (s *offlineStore) JoinList(name string) error {
+	return errOffline
+}
+
+func (s *offlineStore) LeaveList(name string) error {
+	return errOffline
+}
+
+func (s *offlineStore) SetListRole(name string, username string, role string) error {
+	return errOffline
+}
+
+func (s *offlineStore) RemoveListMember(name string, username string) error {
+	return errOffline
+}
+
+func (s *offlineStore) Watch(onChange func(Change)) error {
+	return &UnavailableError{Err: errors.New("the database can't be reached")}
+}
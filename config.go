@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A setting that can be read and changed with wtodo config
+type configKey struct {
+	Name string
+	Get  func(s *Settings) string
+	Set  func(s *Settings, v string) error
+}
+
+// All settings in the config file, in the order they are listed
+var configKeys = []configKey{
+	{"username", func(s *Settings) string { return s.Username }, func(s *Settings, v string) error {
+		return errors.New("use wtodo user rename to change your username, so your items move with it")
+	}},
+	{"backend", func(s *Settings) string { return s.Backend }, func(s *Settings, v string) error {
+		switch v {
+		case FileBackend, PostgresBackend, SqliteBackend, GitBackend:
+			s.Backend = v
+			return nil
+		}
+		return errors.New("backend should be file, postgres, sqlite or git")
+	}},
+	{"database.host", func(s *Settings) string { return s.Database.Host }, func(s *Settings, v string) error {
+		s.Database.Host = v
+		return nil
+	}},
+	{"database.port", func(s *Settings) string { return strconv.Itoa(s.Database.Port) }, func(s *Settings, v string) error {
+		port, err := strconv.Atoi(v)
+		if err != nil || port <= 0 || port > 65535 {
+			return errors.New("port should be a number from 1 to 65535")
+		}
+		s.Database.Port = port
+		return nil
+	}},
+	{"database.user", func(s *Settings) string { return s.Database.User }, func(s *Settings, v string) error {
+		s.Database.User = v
+		return nil
+	}},
+	{"database.password", func(s *Settings) string { return s.Database.Password }, func(s *Settings, v string) error {
+		s.Database.Password = v
+		return nil
+	}},
+	{"database.name", func(s *Settings) string { return s.Database.Name }, func(s *Settings, v string) error {
+		s.Database.Name = v
+		return nil
+	}},
+	{"database.password_command", func(s *Settings) string { return s.Database.PasswordCommand }, func(s *Settings, v string) error {
+		s.Database.PasswordCommand = v
+		return nil
+	}},
+	{"database.sslmode", func(s *Settings) string { return s.Database.SSLMode }, func(s *Settings, v string) error {
+		if v != "" && !validSSLMode(v) {
+			return errors.New("sslmode should be " + strings.Join(sslModes, ", "))
+		}
+		s.Database.SSLMode = v
+		return nil
+	}},
+	{"database.sslrootcert", func(s *Settings) string { return s.Database.SSLRootCert }, func(s *Settings, v string) error {
+		s.Database.SSLRootCert = v
+		return nil
+	}},
+	{"database.sslcert", func(s *Settings) string { return s.Database.SSLCert }, func(s *Settings, v string) error {
+		s.Database.SSLCert = v
+		return nil
+	}},
+	{"database.sslkey", func(s *Settings) string { return s.Database.SSLKey }, func(s *Settings, v string) error {
+		s.Database.SSLKey = v
+		return nil
+	}},
+	{"display.color", func(s *Settings) string { return s.Display.Color }, func(s *Settings, v string) error {
+		switch v {
+		case "", "auto", "always", "never":
+			s.Display.Color = v
+			return nil
+		}
+		return errors.New("color should be auto, always or never")
+	}},
+	{"display.short_ids", func(s *Settings) string { return strconv.FormatBool(s.Display.ShortIds) }, func(s *Settings, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("short_ids should be true or false")
+		}
+		s.Display.ShortIds = b
+		return nil
+	}},
+	{"defaults.priority", func(s *Settings) string { return strconv.Itoa(s.Defaults.Priority) }, func(s *Settings, v string) error {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 0 || p > 3 {
+			return errors.New("priority should be 1 (low), 2 (normal), 3 (high) or 0 to use normal")
+		}
+		s.Defaults.Priority = p
+		return nil
+	}},
+	{"defaults.length", func(s *Settings) string { return s.Defaults.Length }, func(s *Settings, v string) error {
+		switch v {
+		case "", "s", "short", "m", "medium", "l", "long":
+			s.Defaults.Length = v
+			return nil
+		}
+		return errors.New("length should be short, medium or long")
+	}},
+	{"defaults.list", func(s *Settings) string { return s.Defaults.List }, func(s *Settings, v string) error {
+		s.Defaults.List = v
+		return nil
+	}},
+}
+
+// Function to show and change the settings in the config file
+func configCommand(settings *Settings) error {
+	usageInfo := "Usage: wtodo config list | get <key> | set <key> <value>"
+	if len(os.Args) < 3 {
+		return invalidInput(usageInfo)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		fmt.Printf("%s%s%s\n", GREY_C, getConfigPath(), RESET_C)
+		for _, k := range configKeys {
+			v := k.Get(settings)
+			if k.Name == "database.password" && v != "" {
+				v = "********"
+			}
+			fmt.Printf("%s%s%s = %s\n", WHITE_C, k.Name, RESET_C, v)
+		}
+	case "get":
+		if len(os.Args) != 4 {
+			return invalidInput(usageInfo)
+		}
+		k, err := findConfigKey(os.Args[3])
+		if err != nil {
+			return err
+		}
+		fmt.Println(k.Get(settings))
+	case "set":
+		if len(os.Args) != 5 {
+			return invalidInput(usageInfo)
+		}
+		k, err := findConfigKey(os.Args[3])
+		if err != nil {
+			return err
+		}
+		err = k.Set(settings, strings.TrimSpace(os.Args[4]))
+		if err != nil {
+			return invalidInput("Invalid value for %s: %s", k.Name, err)
+		}
+		return savePrefs(settings)
+	default:
+		return invalidInput("Invalid config action: %s\n%s", os.Args[2], usageInfo)
+	}
+	return nil
+}
+
+// Helper function to find a config key by name
+func findConfigKey(name string) (configKey, error) {
+	for _, k := range configKeys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return configKey{}, invalidInput("Unknown config key: %s\nSee all keys with: wtodo config list", name)
+}
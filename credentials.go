@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SSL modes for the database connection, from least to most checked
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// Password from the password command, so it only runs once
+var commandPassword *string
+
+// Helper function to check if an SSL mode is one postgresql knows
+func validSSLMode(mode string) bool {
+	for _, m := range sslModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the password for the database: the one in the settings, the output of the password command,
+// or the matching line in ~/.pgpass (or PGPASSFILE)
+// Returns an empty string if there is none, so the server can use another way to log in
+func resolvePassword(db DatabaseSettings) (string, error) {
+	if db.Password != "" {
+		return db.Password, nil
+	}
+	if db.PasswordCommand != "" {
+		if commandPassword == nil {
+			out, err := exec.Command("sh", "-c", db.PasswordCommand).Output()
+			if err != nil {
+				return "", &UnavailableError{Err: fmt.Errorf("could not run the database password command: %w", err)}
+			}
+			password, _, _ := strings.Cut(string(out), "\n")
+			password = strings.TrimRight(password, "\r")
+			commandPassword = &password
+		}
+		return *commandPassword, nil
+	}
+	return pgpassPassword(db), nil
+}
+
+// Reads the password for the database from the pgpass file,
+// where each line is host:port:database:user:password and * matches anything
+func pgpassPassword(db DatabaseSettings) string {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		path = homeDir + "/.pgpass"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// Like postgresql, ignore the file if others can read it
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "%sIgnoring %s, it should only be readable by you (chmod 0600)%s\n", GREY_C, path, RESET_C)
+		return ""
+	}
+
+	// Unix sockets are matched as localhost
+	host := db.Host
+	if strings.HasPrefix(host, "/") {
+		host = "localhost"
+	}
+	want := []string{host, strconv.Itoa(db.Port), db.Name, db.User}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPgpass(line)
+		if len(fields) != 5 {
+			continue
+		}
+		match := true
+		for i, w := range want {
+			if fields[i] != "*" && fields[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// Helper function to split a pgpass line on colons, where \: and \\ are a colon and backslash
+func splitPgpass(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case line[i] == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, field.String())
+}
+
+// Helper function to replace a leading ~/ in a path with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return homeDir + path[1:]
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPgpass(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{
+			name: "plain fields",
+			line: "db.example.com:5432:todo:bob:secret",
+			want: []string{"db.example.com", "5432", "todo", "bob", "secret"},
+		},
+		{
+			name: "wildcards",
+			line: "*:*:*:bob:secret",
+			want: []string{"*", "*", "*", "bob", "secret"},
+		},
+		{
+			name: "escaped colon",
+			line: `db.example.com:5432:todo:bob:pass\:word`,
+			want: []string{"db.example.com", "5432", "todo", "bob", "pass:word"},
+		},
+		{
+			name: "escaped backslash",
+			line: `db.example.com:5432:todo:bob:pass\\word`,
+			want: []string{"db.example.com", "5432", "todo", "bob", `pass\word`},
+		},
+		{
+			name: "escaped backslash before a colon",
+			line: `db.example.com:5432:todo:bob\\:secret`,
+			want: []string{"db.example.com", "5432", "todo", `bob\`, "secret"},
+		},
+		{
+			name: "trailing backslash is kept",
+			line: `db.example.com:5432:todo:bob:secret\`,
+			want: []string{"db.example.com", "5432", "todo", "bob", `secret\`},
+		},
+		{
+			name: "empty password",
+			line: "db.example.com:5432:todo:bob:",
+			want: []string{"db.example.com", "5432", "todo", "bob", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitPgpass(tt.line)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPgpass(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// Version of the encrypted file format
+const EncryptedVersion = 1
+
+// An encrypted file, the key is made from a passphrase (or the contents of a key file) with scrypt
+type EncryptedFile struct {
+	Version int    `json:"wtodo_encrypted"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	KeyFile string `json:"key_file,omitempty"`
+	Data    []byte `json:"data"`
+}
+
+// Passphrase used to encrypt files, nil if files are saved unencrypted
+// It is set when an encrypted preferences file is loaded
+var secret []byte
+var secretKeyFile string
+
+// Salt used for files saved by this run, so the key only has to be made once
+var writeSalt []byte
+var derivedKeys = make(map[string][]byte)
+
+// Helper function to make the key for a salt from the passphrase
+func deriveKey(salt []byte) ([]byte, error) {
+	key, ok := derivedKeys[string(salt)]
+	if ok {
+		return key, nil
+	}
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Could not make encryption key: %w", err)
+	}
+	derivedKeys[string(salt)] = key
+	return key, nil
+}
+
+// Reads a data file, decrypting it if it is encrypted
+// The passphrase is asked for the first time an encrypted file is read
+func readDataFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f EncryptedFile
+	if json.Unmarshal(content, &f) != nil || f.Version == 0 {
+		return content, nil
+	}
+	if f.Version > EncryptedVersion {
+		return nil, fmt.Errorf("%s was encrypted by a newer version of wtodo", path)
+	}
+
+	if secret == nil {
+		err = unlock(f.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := deriveKey(f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, invalidInput("Could not decrypt %s, the passphrase or key file is wrong", path)
+	}
+	return plain, nil
+}
+
+// Writes a data file, encrypting it if encryption is turned on
+// Only the user can read it, even if it was made readable by older versions
+func writeDataFile(path string, content []byte) error {
+	if secret == nil {
+		return writePrivate(path, content)
+	}
+
+	if writeSalt == nil {
+		salt, err := randomBytes(16)
+		if err != nil {
+			return err
+		}
+		writeSalt = salt
+	}
+	key, err := deriveKey(writeSalt)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return err
+	}
+	f := EncryptedFile{Version: EncryptedVersion, Salt: writeSalt, Nonce: nonce, KeyFile: secretKeyFile}
+	f.Data = gcm.Seal(nil, f.Nonce, content, nil)
+	out, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return writePrivate(path, out)
+}
+
+// Helper function to write a file only the user can read
+func writePrivate(path string, content []byte) error {
+	err := os.WriteFile(path, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// Helper function to make random bytes for salts and nonces
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("Could not make random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// Gets the passphrase to decrypt files, from WTODO_PASSPHRASE, WTODO_KEY_FILE,
+// the key file the files were encrypted with, or by asking the user
+func unlock(keyFile string) error {
+	if pass := os.Getenv("WTODO_PASSPHRASE"); pass != "" {
+		secret = []byte(pass)
+		return nil
+	}
+	if env := os.Getenv("WTODO_KEY_FILE"); env != "" {
+		keyFile = env
+	}
+	if keyFile != "" {
+		key, err := readKeyFile(keyFile)
+		if err != nil {
+			return err
+		}
+		secret, secretKeyFile = key, keyFile
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return invalidInput("wtodo is encrypted, set WTODO_PASSPHRASE or WTODO_KEY_FILE to unlock it")
+	}
+	pass, err := readSecret("Passphrase to unlock wtodo:")
+	if err != nil {
+		return err
+	}
+	secret = []byte(pass)
+	return nil
+}
+
+// Helper function to read the key from a key file
+func readKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, invalidInput("Could not read key file: %s", err)
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) == 0 {
+		return nil, invalidInput("Key file is empty: %s", path)
+	}
+	return key, nil
+}
+
+// Asks the user for a secret without showing it on screen (unless stdin isn't a terminal)
+func readSecret(prompt string) (string, error) {
+	fmt.Printf("%s%s%s ", YELLOW_C, prompt, RESET_C)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, _ := stdin.ReadString('\n')
+		return strings.Trim(line, " \r\n"), nil
+	}
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("Could not read from the terminal: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Function to turn on encryption (or change the passphrase) for the preferences and local data
+// The sqlite database and git repository can't be encrypted, so it refuses to run instead of leaving the items readable
+func encryptCommand(settings Settings) error {
+	var keyFile string
+	encryptFlags := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	encryptFlags.StringVar(&keyFile, "key-file", "", "Use the contents of this file as the key instead of a passphrase")
+	encryptFlags.Parse(os.Args[2:])
+
+	switch settings.Backend {
+	case SqliteBackend:
+		return invalidInput("The sqlite database (%s/items.db) can't be encrypted, use the file or postgresql backend to encrypt your items", getDataDir())
+	case GitBackend:
+		return invalidInput("The git repository (%s/repo) can't be encrypted, as its history would keep the items unencrypted, use the file or postgresql backend to encrypt your items", getDataDir())
+	}
+
+	var newSecret []byte
+	if keyFile != "" {
+		abs, err := filepath.Abs(keyFile)
+		if err != nil {
+			return err
+		}
+		keyFile = abs
+		newSecret, err = readKeyFile(keyFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		pass, err := readSecret("New passphrase:")
+		if err != nil {
+			return err
+		}
+		if pass == "" {
+			return invalidInput("The passphrase can't be empty")
+		}
+		repeat, err := readSecret("Repeat passphrase:")
+		if err != nil {
+			return err
+		}
+		if repeat != pass {
+			return invalidInput("The passphrases don't match")
+		}
+		newSecret = []byte(pass)
+	}
+
+	n, err := rewriteDataFiles(newSecret, keyFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sEncrypted %d files in %s%s\n", LIGHT_GREEN_C, n, getDataDir(), RESET_C)
+	return nil
+}
+
+// Function to turn off encryption
+func decryptCommand() error {
+	if secret == nil {
+		return invalidInput("wtodo is not encrypted")
+	}
+	n, err := rewriteDataFiles(nil, "")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sDecrypted %d files in %s%s\n", LIGHT_GREEN_C, n, getDataDir(), RESET_C)
+	return nil
+}
+
+// Helper function to save all preferences and local data again with a new passphrase (nil for no encryption)
+// Returns the number of files saved
+func rewriteDataFiles(newSecret []byte, keyFile string) (int, error) {
+	dir := getDataDir()
+	paths := []string{getConfigPath(), dir + "/prefs.dat", dir + "/items.json"}
+	for _, pattern := range []string{dir + "/cache/*.json", dir + "/sync-*.json"} {
+		matches, _ := filepath.Glob(pattern)
+		paths = append(paths, matches...)
+	}
+
+	// Read everything with the old passphrase before changing it
+	contents := make(map[string][]byte)
+	for _, path := range paths {
+		content, err := readDataFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		contents[path] = content
+	}
+
+	secret, secretKeyFile, writeSalt = newSecret, keyFile, nil
+	for path, content := range contents {
+		err := writeDataFile(path, content)
+		if err != nil {
+			return 0, fmt.Errorf("Could not save %s: %w", path, err)
+		}
+	}
+	return len(contents), nil
+}
@@ -1,181 +1,936 @@
 package main
 
 import (
-	"bufio"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"io"
+	"net"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
-func getDbInfo(settings *Settings) {
+func getDbInfo(settings *Settings) error {
 	// Reset settings
-	settings.DbHost = ""
-	settings.DbPort = 0
-	settings.DbUser = ""
-	settings.DbPass = ""
-	settings.UseDb = false
-	settings.DbName = ""
+	settings.Database = DatabaseSettings{}
+	settings.Backend = FileBackend
 
-	// Create buffer reader
-	read := bufio.NewReader(os.Stdin)
+	read := stdin
 
-	// Ask the user if they want to use the database
-	fmt.Printf("%sUse Postgresql database? (y/n) [Default n - use local data file]:%s ", YELLOW_C, RESET_C)
-	useDb, _ := read.ReadString('\n')
-	settings.UseDb = strings.ToLower(strings.Trim(useDb, "\n")) == "y"
+	// Ask the user where they want to store items
+	fmt.Printf("%sStore items in a [p]ostgresql database, [s]qlite database, [g]it repository or local data [f]ile? [Default f]:%s ", YELLOW_C, RESET_C)
+	backend, _ := read.ReadString('\n')
+	switch strings.ToLower(strings.Trim(backend, " \n")) {
+	case "p", "postgres", "postgresql", "y":
+		settings.Backend = PostgresBackend
+	case "s", "sqlite":
+		settings.Backend = SqliteBackend
+	case "g", "git":
+		settings.Backend = GitBackend
+	}
 
-	// If no database we done
-	if !settings.UseDb {
-		return
+	// Only the database needs more information
+	if settings.Backend != PostgresBackend {
+		return nil
 	}
 
 	// Prompt for the rest of the inforamtion for the database
 	fmt.Printf("%s\nDatabase Setup\n==============\n%s", LIGHT_GREEN_C, RESET_C)
-	for settings.DbHost == "" {
-		fmt.Printf("%s> Enter Database Host:%s ", YELLOW_C, RESET_C)
+	for settings.Database.Host == "" {
+		fmt.Printf("%s> Enter Database Host (or unix socket directory):%s ", YELLOW_C, RESET_C)
 		name, _ := read.ReadString('\n')
-		settings.DbHost = strings.Trim(name, " \n")
+		settings.Database.Host = strings.Trim(name, " \n")
 	}
 
 	fmt.Printf("%s> Enter Database Port [Default 5432]:%s ", YELLOW_C, RESET_C)
 	port, _ := read.ReadString('\n')
 	var err error
-	settings.DbPort, err = strconv.Atoi(strings.Trim(port, " \n"))
+	settings.Database.Port, err = strconv.Atoi(strings.Trim(port, " \n"))
 	if err != nil {
-		settings.DbPort = 5432
+		settings.Database.Port = 5432
 	}
 
-	for settings.DbUser == "" {
+	for settings.Database.User == "" {
 		fmt.Printf("%s> Enter Database Username:%s ", YELLOW_C, RESET_C)
 		name, _ := read.ReadString('\n')
-		settings.DbUser = strings.Trim(name, " \n")
+		settings.Database.User = strings.Trim(name, " \n")
 	}
 
-	for settings.DbPass == "" {
-		fmt.Printf("%s> Enter Database Password:%s ", YELLOW_C, RESET_C)
-		name, _ := read.ReadString('\n')
-		settings.DbPass = strings.Trim(name, " \n")
+	// The password isn't shown while it is typed
+	settings.Database.Password, err = readSecret("> Enter Database Password [Leave empty to use ~/.pgpass]:")
+	if err != nil {
+		return err
 	}
 
-	for settings.DbName == "" {
+	for settings.Database.Name == "" {
 		fmt.Printf("%s> Enter Database Name:%s ", YELLOW_C, RESET_C)
 		name, _ := read.ReadString('\n')
-		settings.DbName = strings.Trim(name, " \n")
+		settings.Database.Name = strings.Trim(name, " \n")
+	}
+
+	for settings.Database.SSLMode == "" {
+		fmt.Printf("%s> Enter SSL Mode (disable, require, verify-ca, verify-full) [Default disable]:%s ", YELLOW_C, RESET_C)
+		mode, _ := read.ReadString('\n')
+		settings.Database.SSLMode = strings.Trim(mode, " \n")
+		if settings.Database.SSLMode == "" {
+			settings.Database.SSLMode = "disable"
+		} else if !validSSLMode(settings.Database.SSLMode) {
+			fmt.Printf("%sInvalid SSL mode: %s%s\n", RED_C, settings.Database.SSLMode, RESET_C)
+			settings.Database.SSLMode = ""
+		}
+	}
+
+	// Verifying the server needs the certificate of the authority that signed it
+	if strings.HasPrefix(settings.Database.SSLMode, "verify") {
+		fmt.Printf("%s> Enter CA Certificate Path [Default ~/.postgresql/root.crt]:%s ", YELLOW_C, RESET_C)
+		path, _ := read.ReadString('\n')
+		settings.Database.SSLRootCert = strings.Trim(path, " \n")
 	}
 
-	fmt.Printf("%s\nSetup complete!%s\n===============\nHost: %s\nPort: %d\nUsername: %s\nPassword: %s\nDB Name: %s\n\n", WHITE_C, RESET_C, settings.DbHost, settings.DbPort, settings.DbUser, settings.DbPass, settings.DbName)
+	password := "********"
+	if settings.Database.Password == "" {
+		password = "(from ~/.pgpass)"
+	}
+	fmt.Printf("%s\nSetup complete!%s\n===============\nHost: %s\nPort: %d\nUsername: %s\nPassword: %s\nDB Name: %s\nSSL Mode: %s\n\n", WHITE_C, RESET_C, settings.Database.Host, settings.Database.Port, settings.Database.User, password, settings.Database.Name, settings.Database.SSLMode)
+	return nil
+}
+
+// Connection to a postgresql or sqlite database
+// Queries are written for postgresql and rewritten by rebind when running on sqlite
+type Database struct {
+	*sql.DB
+	sqlite bool
+}
+
+func (d *Database) Exec(q string, args ...any) (sql.Result, error) {
+	return d.DB.Exec(d.rebind(q), args...)
+}
+
+func (d *Database) Query(q string, args ...any) (*sql.Rows, error) {
+	return d.DB.Query(d.rebind(q), args...)
 }
 
-// Connects to database using the info stored in settings
-func connectDb(settings Settings) *sql.DB {
-	// Connect to the database
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", settings.DbHost, settings.DbPort, settings.DbUser, settings.DbPass, settings.DbName)
-	db, err := sql.Open("postgres", connStr)
+func (d *Database) QueryRow(q string, args ...any) *sql.Row {
+	return d.DB.QueryRow(d.rebind(q), args...)
+}
+
+// Current time in sqlite, in a format the driver reads back as a time
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+var paramRegexp = regexp.MustCompile(`\$(\d+)`)
+var addColumnRegexp = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+
+// Helper function to rewrite a query for sqlite
+// $1 parameters are bound in the order they first appear in sqlite, but ?1 parameters are bound by number like postgresql
+func (d *Database) rebind(q string) string {
+	if !d.sqlite {
+		return q
+	}
+	q = paramRegexp.ReplaceAllString(q, "?$1")
+	return strings.ReplaceAll(q, "now()", sqliteNow)
+}
+
+// Runs a statement from createTables, rewriting it for sqlite
+func (d *Database) migrate(q string) error {
+	if d.sqlite {
+		var err error
+		q, err = d.sqliteSchema(q)
+		if err != nil || q == "" {
+			return err
+		}
+	}
+	_, err := d.Exec(q)
+	return dbError(err)
+}
+
+// Helper function to rewrite a schema change for sqlite, empty if it isn't needed there
+func (d *Database) sqliteSchema(q string) (string, error) {
+	// Constraints from old postgresql tables never existed on sqlite
+	if strings.Contains(q, "DROP CONSTRAINT") {
+		return "", nil
+	}
+
+	// sqlite can't skip columns that already exist, or add columns with a default that isn't constant
+	// (items are always inserted with updated_at, so the default is never used)
+	if m := addColumnRegexp.FindStringSubmatch(q); m != nil {
+		var n int
+		err := d.DB.QueryRow("SELECT count(*) FROM pragma_table_info(?) WHERE name=?", m[1], m[2]).Scan(&n)
+		if err != nil {
+			return "", dbError(err)
+		}
+		if n > 0 {
+			return "", nil
+		}
+		q = strings.Replace(q, " IF NOT EXISTS", "", 1)
+		q = strings.ReplaceAll(q, "DEFAULT now()", "DEFAULT '1970-01-01 00:00:00'")
+	}
+
+	q = strings.ReplaceAll(q, "serial PRIMARY KEY", "integer PRIMARY KEY AUTOINCREMENT")
+	q = strings.ReplaceAll(q, "timestamp with time zone", "timestamp")
+	return strings.ReplaceAll(q, "DEFAULT now()", "DEFAULT ("+sqliteNow+")"), nil
+}
+
+// Connects to database using the info stored in settings, returning an *UnavailableError if it can't be reached or logged in to
+func openDb(settings Settings) (*Database, error) {
+	conn, err := connString(settings)
 	if err != nil {
-		log.Fatal("Could not open DB: ", err)
+		return nil, err
+	}
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		return nil, &UnavailableError{Err: fmt.Errorf("could not open the database: %w", err)}
 	}
 	err = db.Ping()
 	if err != nil {
-		log.Fatal("Database ping failed: ", err)
+		db.Close()
+
+		// Only errors from the connection mean the server can't be reached, others like a wrong password come from the settings
+		var unavailable *UnavailableError
+		if errors.As(dbError(err), &unavailable) {
+			return nil, &UnavailableError{Err: fmt.Errorf("could not connect to the database: %w", err), Unreachable: true}
+		}
+		return nil, &UnavailableError{Err: fmt.Errorf("the database refused the connection: %w", err)}
+	}
+	return &Database{DB: db}, nil
+}
+
+// Opens the sqlite database at the given path, creating it if it does not exist
+func openSqlite(path string) (*Database, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, &UnavailableError{Err: fmt.Errorf("could not open the sqlite database: %w", err)}
+	}
+	return &Database{DB: db, sqlite: true}, nil
+}
+
+// Creates the connection string for the database in the settings,
+// telling it the username for the row level security policies
+func connString(settings Settings) (string, error) {
+	db := settings.Database
+	sslMode := db.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	params := []string{
+		"host=" + connQuote(db.Host),
+		fmt.Sprintf("port=%d", db.Port),
+		"user=" + connQuote(db.User),
+		"dbname=" + connQuote(db.Name),
+		"sslmode=" + connQuote(sslMode),
+		"connect_timeout=5",
+		"options=" + connQuote("-c wtodo.user="+strings.ReplaceAll(settings.Username, " ", "\\ ")),
+	}
+	password, err := resolvePassword(db)
+	if err != nil {
+		return "", err
 	}
-	return db
+	if password != "" {
+		params = append(params, "password="+connQuote(password))
+	}
+	for _, cert := range [][2]string{{"sslrootcert", db.SSLRootCert}, {"sslcert", db.SSLCert}, {"sslkey", db.SSLKey}} {
+		if cert[1] != "" {
+			params = append(params, cert[0]+"="+connQuote(expandHome(cert[1])))
+		}
+	}
+	return strings.Join(params, " "), nil
 }
 
-// Create database tables
-func createTables(db *sql.DB) {
+// Create database tables, or update them from older versions
+// The same statements are used for sqlite, where migrate rewrites the ones that are written only for postgresql
+func createTables(db *Database) error {
 	err := db.Ping()
 	if err != nil {
-		log.Fatal("Database disconnected :( ", err)
+		return &UnavailableError{Err: fmt.Errorf("database disconnected: %w", err)}
 	}
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS Item (id serial PRIMARY KEY, name varchar(100) NOT NULL, due timestamp with time zone, start timestamp with time zone, length smallint, priority smallint, finished boolean);")
-	_, err2 := db.Exec("CREATE TABLE IF NOT EXISTS Tag (item_id integer PRIMARY KEY, name varchar(50));")
+
+	steps := []struct {
+		What    string
+		Queries []string
+	}{
+		{"creating item table", []string{"CREATE TABLE IF NOT EXISTS Item (id serial PRIMARY KEY, name varchar(100) NOT NULL, due timestamp with time zone, start timestamp with time zone, length smallint, priority smallint, finished boolean);"}},
+		{"creating tag table", []string{"CREATE TABLE IF NOT EXISTS Tag (item_id integer NOT NULL, name varchar(50) NOT NULL);"}},
+
+		// Older tag tables used item_id as the primary key, which only allowed one tag per item
+		{"updating tag table", []string{"ALTER TABLE Tag DROP CONSTRAINT IF EXISTS tag_pkey;"}},
+
+		// Maps ids from other programs (eg. Taskwarrior UUIDs) to our items
+		{"creating external id table", []string{"CREATE TABLE IF NOT EXISTS ExternalId (source varchar(20) NOT NULL, external_id varchar(64) NOT NULL, item_id integer NOT NULL);"}},
+
+		// Items and external ids belong to the user that made them
+		{"adding item owners", []string{
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS owner varchar(100);",
+			"CREATE INDEX IF NOT EXISTS item_owner_idx ON Item (owner);",
+			"ALTER TABLE ExternalId ADD COLUMN IF NOT EXISTS owner varchar(100);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS externalid_owner_idx ON ExternalId (owner, source, external_id);",
+		}},
+
+		// Shared lists that users can join, items can be in a list and assigned to a user
+		{"creating list tables", []string{
+			"CREATE TABLE IF NOT EXISTS List (id serial PRIMARY KEY, name varchar(50) NOT NULL UNIQUE, owner varchar(100) NOT NULL);",
+			"CREATE TABLE IF NOT EXISTS ListMember (list_id integer NOT NULL, username varchar(100) NOT NULL, PRIMARY KEY (list_id, username));",
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS list_id integer;",
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS assignee varchar(100);",
+			"ALTER TABLE ListMember ADD COLUMN IF NOT EXISTS role varchar(10) NOT NULL DEFAULT 'editor';",
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT now();",
+			"UPDATE ListMember SET role='owner' WHERE role<>'owner' AND EXISTS (SELECT 1 FROM List l WHERE l.id=ListMember.list_id AND l.owner=ListMember.username);",
+		}},
+
+		// Comments left on items
+		{"creating comment table", []string{
+			"CREATE TABLE IF NOT EXISTS Comment (id serial PRIMARY KEY, item_id integer NOT NULL, author varchar(100) NOT NULL, created timestamp with time zone NOT NULL DEFAULT now(), body text NOT NULL);",
+			"CREATE INDEX IF NOT EXISTS comment_item_idx ON Comment (item_id);",
+		}},
+
+		// Items get a UUID when they are made, so they can be told apart across databases
+		{"adding item uuids", []string{
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS uuid varchar(36);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS item_uuid_idx ON Item (uuid);",
+		}},
+
+		// Items remember when they were added, older items use their last update instead
+		{"adding item creation dates", []string{
+			"ALTER TABLE Item ADD COLUMN IF NOT EXISTS created_at timestamp with time zone;",
+			"UPDATE Item SET created_at=updated_at WHERE created_at IS NULL;",
+		}},
+	}
+	for _, step := range steps {
+		for _, q := range step.Queries {
+			err = db.migrate(q)
+			if err != nil {
+				return fmt.Errorf("Error %s: %w", step.What, err)
+			}
+		}
+	}
+	err = fillUuids(db)
+	if err != nil {
+		return fmt.Errorf("Error adding item uuids: %w", err)
+	}
+
+	// Only postgresql has row level security and notifications, which both use wtodo_user()
+	if !db.sqlite {
+		err = ownerStatements(db, []string{userFunction})
+		if err == nil {
+			err = enableRowSecurity(db)
+		}
+		if err == nil {
+			err = enableNotify(db)
+		}
+		if err != nil {
+			return fmt.Errorf("Error adding row level security and notifications: %w", err)
+		}
+	}
+	return nil
+}
+
+// Function giving the user sent by connString in the wtodo.user setting, NULL for connections without it
+const userFunction = "CREATE OR REPLACE FUNCTION wtodo_user() RETURNS text AS $$ SELECT NULLIF(current_setting('wtodo.user', true), '') $$ LANGUAGE sql STABLE;"
+
+// Runs statements that only the owner of the tables can run
+// Other database users stop at the first one they aren't allowed to run, as the owner already ran them
+func ownerStatements(db *Database, queries []string) error {
+	for _, q := range queries {
+		_, err := db.Exec(q)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "42501" {
+			return nil
+		} else if err != nil {
+			return dbError(err)
+		}
+	}
+	return nil
+}
+
+// Adds triggers that send a notification on the wtodo_changes channel whenever an item or comment changes
+// The payload is a JSON object with the table, operation (insert, update or delete), item id and user
+// Only the owner of the table can do this, so it is skipped for other database users
+func enableNotify(db *Database) error {
+	return ownerStatements(db, []string{
+		`CREATE OR REPLACE FUNCTION wtodo_notify() RETURNS trigger AS $$
+		DECLARE r record;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN r := OLD; ELSE r := NEW; END IF;
+			PERFORM pg_notify('wtodo_changes', json_build_object('table', lower(TG_TABLE_NAME), 'op', lower(TG_OP), 'id', (to_jsonb(r) ->> TG_ARGV[0])::integer, 'user', COALESCE(wtodo_user(), ''))::text);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;`,
+		"DROP TRIGGER IF EXISTS item_notify ON Item;",
+		"CREATE TRIGGER item_notify AFTER INSERT OR UPDATE OR DELETE ON Item FOR EACH ROW EXECUTE PROCEDURE wtodo_notify('id');",
+		"DROP TRIGGER IF EXISTS comment_notify ON Comment;",
+		"CREATE TRIGGER comment_notify AFTER INSERT OR UPDATE OR DELETE ON Comment FOR EACH ROW EXECUTE PROCEDURE wtodo_notify('item_id');",
+	})
+}
+
+// Adds row level security policies to the item, tag and comment tables matching the permissions checked by the store
+// The user is read from the wtodo.user setting sent by connString, and connections without it are not limited
+// Only the owner of the table can do this, so it is skipped for other database users
+func enableRowSecurity(db *Database) error {
+	editorOf := "EXISTS (SELECT 1 FROM ListMember m WHERE m.list_id=%[1]s.list_id AND m.username=wtodo_user() AND m.role IN ('owner', 'editor'))"
+	canEdit := "(%[1]s.owner=wtodo_user() OR %[1]s.assignee=wtodo_user() OR " + editorOf + ")"
+	itemEditor := fmt.Sprintf(canEdit, "Item")
+
+	// Tags and comments follow their item, and the ones left behind by deleted items can be cleaned up by anyone
+	itemOf := func(table string, cond string) string {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM Item i WHERE i.id=%s.item_id AND %s)", table, cond)
+	}
+	orphan := func(table string) string {
+		return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM Item i WHERE i.id=%s.item_id)", table)
+	}
+	tagEditor := itemOf("Tag", fmt.Sprintf(canEdit, "i"))
+	commentEditor := itemOf("Comment", fmt.Sprintf(canEdit, "i"))
+
+	var queries []string
+	for _, table := range []string{"Item", "Tag", "Comment"} {
+		queries = append(queries,
+			"ALTER TABLE "+table+" ENABLE ROW LEVEL SECURITY;",
+			"ALTER TABLE "+table+" FORCE ROW LEVEL SECURITY;",
+		)
+	}
+	return ownerStatements(db, append(queries,
+		"DROP POLICY IF EXISTS item_select ON Item;",
+		"CREATE POLICY item_select ON Item FOR SELECT USING (true);",
+		"DROP POLICY IF EXISTS item_insert ON Item;",
+		"CREATE POLICY item_insert ON Item FOR INSERT WITH CHECK (wtodo_user() IS NULL OR (owner=wtodo_user() AND (list_id IS NULL OR "+fmt.Sprintf(editorOf, "Item")+")));",
+
+		// Items without an owner can only be changed by claiming them, and changes can't take an item away from its owner
+		"DROP POLICY IF EXISTS item_update ON Item;",
+		"CREATE POLICY item_update ON Item FOR UPDATE USING (wtodo_user() IS NULL OR owner IS NULL OR "+itemEditor+") WITH CHECK (wtodo_user() IS NULL OR (owner IS NOT NULL AND "+itemEditor+"));",
+		"DROP POLICY IF EXISTS item_delete ON Item;",
+		"CREATE POLICY item_delete ON Item FOR DELETE USING (wtodo_user() IS NULL OR owner=wtodo_user() OR "+fmt.Sprintf(editorOf, "Item")+");",
+
+		"DROP POLICY IF EXISTS tag_select ON Tag;",
+		"CREATE POLICY tag_select ON Tag FOR SELECT USING (true);",
+		"DROP POLICY IF EXISTS tag_insert ON Tag;",
+		"CREATE POLICY tag_insert ON Tag FOR INSERT WITH CHECK (wtodo_user() IS NULL OR "+tagEditor+");",
+		"DROP POLICY IF EXISTS tag_delete ON Tag;",
+		"CREATE POLICY tag_delete ON Tag FOR DELETE USING (wtodo_user() IS NULL OR "+orphan("Tag")+" OR "+tagEditor+");",
+
+		// Anyone who can see an item can comment on it, and its owner can restore the comments of others from a backup
+		"DROP POLICY IF EXISTS comment_select ON Comment;",
+		"CREATE POLICY comment_select ON Comment FOR SELECT USING (true);",
+		"DROP POLICY IF EXISTS comment_insert ON Comment;",
+		"CREATE POLICY comment_insert ON Comment FOR INSERT WITH CHECK (wtodo_user() IS NULL OR author=wtodo_user() OR "+itemOf("Comment", "i.owner=wtodo_user()")+");",
+		"DROP POLICY IF EXISTS comment_delete ON Comment;",
+		"CREATE POLICY comment_delete ON Comment FOR DELETE USING (wtodo_user() IS NULL OR "+orphan("Comment")+" OR "+commentEditor+");",
+	))
+}
+
+// Gives items made before items had owners to a user, returning how many were given
+func claimItems(db *Database, owner string) (int, error) {
+	res, err := db.Exec("UPDATE Item SET owner=$1 WHERE owner IS NULL", owner)
 	if err != nil {
-		log.Fatal("Error creating item table:", err)
+		return 0, dbError(err)
 	}
-	if err2 != nil {
-		log.Fatal("Error creating tag table:", err2)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError(err)
+	}
+	_, err = db.Exec("UPDATE ExternalId SET owner=$1 WHERE owner IS NULL", owner)
+	return int(n), dbError(err)
+}
+
+// Counts the items made before items had owners, which nobody has claimed yet
+func countUnowned(db *Database) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM Item WHERE owner IS NULL").Scan(&n)
+	return n, dbError(err)
+}
+
+// Gives a UUID to the items made before items had them
+func fillUuids(db *Database) error {
+	rows, err := db.Query("SELECT id FROM Item WHERE uuid IS NULL")
+	if err != nil {
+		return dbError(err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		uuid, err := newUUID()
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("UPDATE Item SET uuid=$1 WHERE id=$2 AND uuid IS NULL", uuid, id)
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	return nil
+}
+
+// Columns selected for each item from itemTables, in the order they are scanned by scanItem
+const itemColumns = "i.id, i.name, i.due, i.start, i.length, i.priority, i.finished, i.owner, COALESCE(l.name, ''), COALESCE(i.assignee, ''), (SELECT count(*) FROM Comment c WHERE c.item_id=i.id), i.created_at, i.updated_at, COALESCE(i.uuid, '')"
+const itemTables = "Item i LEFT JOIN List l ON l.id=i.list_id"
+
+// Condition for the items a user can see: their own, ones assigned to them and ones in lists they joined
+// The username is the nth query parameter
+func visibleTo(n int) string {
+	return fmt.Sprintf("(i.owner=$%[1]d OR i.assignee=$%[1]d OR i.list_id IN (SELECT list_id FROM ListMember WHERE username=$%[1]d))", n)
+}
+
+// Helper function to scan a row selected with itemColumns
+// Items of other users made before creation dates were kept may not have one yet, so their last update is used
+func scanItem(rows *sql.Rows) (Item, error) {
+	var it Item
+	var created sql.NullTime
+	err := rows.Scan(&it.Id, &it.Name, &it.Due, &it.Start, &it.Length, &it.Priority, &it.Finished, &it.Owner, &it.List, &it.Assignee, &it.Comments, &created, &it.Updated, &it.Uuid)
+	it.Created = it.Updated
+	if created.Valid {
+		it.Created = created.Time
 	}
+	return it, err
 }
 
-// Selects all from item table
-func selectAll(db *sql.DB) []Item {
+// Selects all items a user can see, including finished items if specified
+func selectAll(db *Database, owner string, finished bool) ([]Item, error) {
 	// Load current timezone
 	americaTime := time.Now().Location()
 
 	// Perform select
-	q := `SELECT * FROM Item WHERE finished=false`
-	rows, err := db.Query(q)
+	q := `SELECT ` + itemColumns + ` FROM ` + itemTables + ` WHERE ` + visibleTo(1) + ` AND i.finished=false ORDER BY i.id`
+	if finished {
+		q = `SELECT ` + itemColumns + ` FROM ` + itemTables + ` WHERE ` + visibleTo(1) + ` ORDER BY i.id`
+	}
+	rows, err := db.Query(q, owner)
 	if err != nil {
-		log.Fatal("Error selecting all items:", err)
+		return nil, dbError(err)
 	}
 
 	// Iterate through selection and save to struct
 	var temp []Item
 	for rows.Next() {
-		var it Item
-		err := rows.Scan(&it.Id, &it.Name, &it.Due, &it.Start, &it.Length, &it.Priority, &it.Finished)
+		it, err := scanItem(rows)
 		if err != nil {
-			log.Fatal("Error loading row:", err)
+			rows.Close()
+			return nil, dbError(err)
 		}
 		it.Due = it.Due.In(americaTime)
 		temp = append(temp, it)
 	}
+	rows.Close()
+
+	// Load the tags of all the items at once
+	index := make(map[int]int)
+	for i, it := range temp {
+		index[it.Id] = i
+	}
+	rows, err = db.Query("SELECT t.item_id, t.name FROM Tag t JOIN Item i ON i.id=t.item_id WHERE "+visibleTo(1)+" ORDER BY t.name", owner)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var tag string
+		err = rows.Scan(&id, &tag)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		if i, ok := index[id]; ok {
+			temp[i].Tags = append(temp[i].Tags, tag)
+		}
+	}
 
-	return temp
+	return temp, nil
 }
 
-// Insert item into database
-func insertItem(db *sql.DB, item Item) {
-	_, err := db.Exec("INSERT INTO Item VALUES (DEFAULT, $1, $2, $3, $4, $5, $6)", item.Name, item.Due, item.Start, item.Length, item.Priority, item.Finished)
+// Insert item owned by a user into database and return its new id
+// The item is only put in its list if the list exists, and gets a new UUID (and creation date) if it doesn't have one
+func insertItem(db *Database, owner string, item Item) (int, error) {
+	var err error
+	if item.Uuid == "" {
+		item.Uuid, err = newUUID()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if item.Created.IsZero() {
+		item.Created = time.Now()
+	}
+	var id int
+	err = db.QueryRow("INSERT INTO Item (name, due, start, length, priority, finished, owner, list_id, assignee, updated_at, uuid, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT id FROM List WHERE name=$8), NULLIF($9, ''), now(), $10, $11) RETURNING id", item.Name, item.Due, item.Start, item.Length, item.Priority, item.Finished, owner, item.List, item.Assignee, item.Uuid, item.Created).Scan(&id)
 	if err != nil {
-		panic(err.Error())
+		return 0, dbError(err)
 	}
+	return id, updateTags(db, id, item.Tags)
 }
 
-// Update item from database
-func updateItem(db *sql.DB, item Item) {
-	_, err := db.Exec("UPDATE Item SET name=$1, due=$2, start=$3, length=$4, priority=$5, finished=$6 WHERE id=$7", item.Name, item.Due, item.Start, item.Length, item.Priority, item.Finished, item.Id)
+// Update item a user can see from database
+func updateItem(db *Database, owner string, item Item) error {
+	res, err := db.Exec("UPDATE Item AS i SET name=$1, due=$2, start=$3, length=$4, priority=$5, finished=$6, list_id=(SELECT id FROM List WHERE name=$9), assignee=NULLIF($10, ''), updated_at=now() WHERE i.id=$7 AND "+visibleTo(8), item.Name, item.Due, item.Start, item.Length, item.Priority, item.Finished, item.Id, owner, item.List, item.Assignee)
 	if err != nil {
-		panic(err.Error())
+		return dbError(err)
 	}
+
+	// Only change the tags if the user can see the item
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &NotFoundError{What: "item", Id: item.Id}
+	}
+	return updateTags(db, item.Id, item.Tags)
 }
 
-// Select specific item from database
-func selectItem(db *sql.DB, key int) Item {
-	rows, err := db.Query("SELECT * FROM Item WHERE id=$1", key)
+// Select the tags of an item
+func selectTags(db *Database, id int) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM Tag WHERE item_id=$1 ORDER BY name", id)
 	if err != nil {
-		panic(err.Error())
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Replace the tags of an item
+func updateTags(db *Database, id int, tags []string) error {
+	_, err := db.Exec("DELETE FROM Tag WHERE item_id=$1", id)
+	if err != nil {
+		return dbError(err)
+	}
+	for _, tag := range tags {
+		_, err = db.Exec("INSERT INTO Tag VALUES ($1, $2)", id, tag)
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	return nil
+}
+
+// Select specific item a user can see from database, a *NotFoundError if there is none
+func selectItem(db *Database, owner string, key int) (Item, error) {
+	rows, err := db.Query("SELECT "+itemColumns+" FROM "+itemTables+" WHERE i.id=$1 AND "+visibleTo(2), key, owner)
+	if err != nil {
+		return Item{}, dbError(err)
 	}
 
 	var temp Item
 	if rows.Next() {
-		err = rows.Scan(&temp.Id, &temp.Name, &temp.Due, &temp.Start, &temp.Length, &temp.Priority, &temp.Finished)
+		temp, err = scanItem(rows)
 		if err != nil {
-			panic(err.Error())
+			rows.Close()
+			return Item{}, dbError(err)
 		}
 	}
+	rows.Close()
 
-	return temp
+	if temp.Id == 0 {
+		return Item{}, &NotFoundError{What: "item", Id: key}
+	}
+	temp.Tags, err = selectTags(db, temp.Id)
+	return temp, err
 }
 
-// Update an item to be finished
-func updateFinishItem(db *sql.DB, id int) {
-	_, err := db.Exec("UPDATE Item SET finished=true WHERE id=$1", id)
+// Update an item a user can see to be finished
+func updateFinishItem(db *Database, owner string, id int) error {
+	res, err := db.Exec("UPDATE Item AS i SET finished=true, updated_at=now() WHERE i.id=$1 AND "+visibleTo(2), id, owner)
 	if err != nil {
-		panic(err.Error())
+		return dbError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &NotFoundError{What: "item", Id: id}
 	}
+	return nil
 }
 
-// Deletes a todo item
-func deleteItemDb(db *sql.DB, id int) {
-	_, err := db.Exec("DELETE FROM Item WHERE id=$1", id)
+// Deletes a todo item a user can see along with its tags, comments and external ids
+func deleteItemDb(db *Database, owner string, id int) error {
+	res, err := db.Exec("DELETE FROM Item AS i WHERE i.id=$1 AND "+visibleTo(2), id, owner)
 	if err != nil {
-		panic(err.Error())
+		return dbError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &NotFoundError{What: "item", Id: id}
+	}
+	for _, q := range []string{
+		"DELETE FROM Tag WHERE item_id=$1",
+		"DELETE FROM ExternalId WHERE item_id=$1",
+		"DELETE FROM Comment WHERE item_id=$1",
+	} {
+		_, err = db.Exec(q, id)
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	return nil
+}
+
+// Select the comments of an item, oldest first
+func selectComments(db *Database, id int) ([]Comment, error) {
+	rows, err := db.Query("SELECT id, item_id, author, created, body FROM Comment WHERE item_id=$1 ORDER BY created, id", id)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return scanComments(rows)
+}
+
+// Select the comments on every item a user can see, oldest first
+func selectVisibleComments(db *Database, owner string) ([]Comment, error) {
+	rows, err := db.Query("SELECT c.id, c.item_id, c.author, c.created, c.body FROM Comment c JOIN Item i ON i.id=c.item_id WHERE "+visibleTo(1)+" ORDER BY c.created, c.id", owner)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return scanComments(rows)
+}
+
+// Helper function to scan and close rows of comments
+func scanComments(rows *sql.Rows) ([]Comment, error) {
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(&c.Id, &c.ItemId, &c.Author, &c.Created, &c.Body)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		c.Created = c.Created.Local()
+		comments = append(comments, c)
+	}
+	return comments, nil
+}
+
+// Add a comment to an item
+func insertComment(db *Database, c Comment) error {
+	_, err := db.Exec("INSERT INTO Comment (item_id, author, created, body) VALUES ($1, $2, $3, $4)", c.ItemId, c.Author, c.Created, c.Body)
+	return dbError(err)
+}
+
+// Select the item id mapped to an id from another program, 0 if there is none
+func selectExternalId(db *Database, owner string, source string, externalId string) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT item_id FROM ExternalId WHERE owner=$1 AND source=$2 AND external_id=$3", owner, source, externalId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, dbError(err)
+}
+
+// Select all ids from another program, keyed by item id
+func selectExternalIds(db *Database, owner string, source string) (map[int]string, error) {
+	rows, err := db.Query("SELECT item_id, external_id FROM ExternalId WHERE owner=$1 AND source=$2", owner, source)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	ids := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var externalId string
+		err = rows.Scan(&id, &externalId)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		ids[id] = externalId
 	}
+	return ids, nil
+}
+
+// Map an id from another program to an item
+func insertExternalId(db *Database, owner string, source string, externalId string, id int) error {
+	_, err := db.Exec("INSERT INTO ExternalId (source, external_id, item_id, owner) VALUES ($1, $2, $3, $4) ON CONFLICT (owner, source, external_id) DO UPDATE SET item_id=$3", source, externalId, id, owner)
+	return dbError(err)
+}
+
+// Columns that hold a username, checked and changed together when a user is renamed
+var userColumns = [][2]string{
+	{"Item", "owner"},
+	{"Item", "assignee"},
+	{"ExternalId", "owner"},
+	{"List", "owner"},
+	{"ListMember", "username"},
+	{"Comment", "author"},
+}
+
+// Checks if a user has any items, external ids, lists, list memberships, assigned items or comments
+func ownerExists(db *Database, owner string) (bool, error) {
+	var checks []string
+	for _, c := range userColumns {
+		checks = append(checks, fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s=$1)", c[0], c[1]))
+	}
+	var exists bool
+	err := db.QueryRow("SELECT "+strings.Join(checks, " OR "), owner).Scan(&exists)
+	return exists, dbError(err)
+}
+
+// Moves everything of a user to a new username in one transaction, so a failure doesn't leave them split between both
+func renameOwner(db *Database, oldOwner string, newOwner string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback()
+
+	// The rows move to a name the row level security policies don't allow yet, so they are lifted for this transaction only
+	if !db.sqlite {
+		_, err = tx.Exec("SELECT set_config('wtodo.user', '', true)")
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	for _, c := range userColumns {
+		_, err = tx.Exec(db.rebind(fmt.Sprintf("UPDATE %s SET %s=$1 WHERE %s=$2", c[0], c[1], c[1])), newOwner, oldOwner)
+		if err != nil {
+			return dbError(err)
+		}
+	}
+	return dbError(tx.Commit())
+}
+
+// Select the lists a user is a member of, with all of their members
+func selectLists(db *Database, username string) ([]TodoList, error) {
+	rows, err := db.Query("SELECT l.name, l.owner, m.username, m.role FROM List l JOIN ListMember m ON m.list_id=l.id WHERE l.id IN (SELECT list_id FROM ListMember WHERE username=$1) ORDER BY l.name, m.username", username)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var lists []TodoList
+	for rows.Next() {
+		var name, owner string
+		var member ListMember
+		err = rows.Scan(&name, &owner, &member.Username, &member.Role)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		if len(lists) == 0 || lists[len(lists)-1].Name != name {
+			lists = append(lists, TodoList{Name: name, Owner: owner})
+		}
+		lists[len(lists)-1].Members = append(lists[len(lists)-1].Members, member)
+	}
+	return lists, nil
+}
+
+// Select the role of a user in a list, empty if they are not a member
+func selectListRole(db *Database, username string, name string) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT m.role FROM ListMember m JOIN List l ON l.id=m.list_id WHERE m.username=$1 AND l.name=$2", username, name).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, dbError(err)
+}
+
+// Select who can change an item and the role of a user in its list
+// Returns false if the user can't see the item
+func selectItemAccess(db *Database, username string, id int) (ItemAccess, bool, error) {
+	var a ItemAccess
+	err := db.QueryRow("SELECT COALESCE(i.owner, ''), COALESCE(i.assignee, ''), COALESCE(l.name, ''), COALESCE(m.role, '') FROM Item i LEFT JOIN List l ON l.id=i.list_id LEFT JOIN ListMember m ON m.list_id=i.list_id AND m.username=$2 WHERE i.id=$1 AND "+visibleTo(2), id, username).Scan(&a.Owner, &a.Assignee, &a.List, &a.Role)
+	if err == sql.ErrNoRows {
+		return a, false, nil
+	} else if err != nil {
+		return a, false, dbError(err)
+	}
+	return a, true, nil
+}
+
+// Create a list and make its owner a member, returns false if the name is taken
+func insertList(db *Database, owner string, name string) (bool, error) {
+	var id int
+	err := db.QueryRow("INSERT INTO List (name, owner) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING RETURNING id", name, owner).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, dbError(err)
+	}
+	_, err = db.Exec("INSERT INTO ListMember (list_id, username, role) VALUES ($1, $2, 'owner')", id, owner)
+	return err == nil, dbError(err)
+}
+
+// Add a user to a list with a role, keeping their role if they are already a member
+// Returns false if there is no list with the name
+func insertListMember(db *Database, username string, name string, role string) (bool, error) {
+	res, err := db.Exec("INSERT INTO ListMember (list_id, username, role) SELECT id, $1, $3 FROM List WHERE name=$2 ON CONFLICT DO NOTHING", username, name, role)
+	if err != nil {
+		return false, dbError(err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM List WHERE name=$1)", name).Scan(&exists)
+	return exists, dbError(err)
+}
+
+// Remove a user from a list, returns false if they were not a member
+func deleteListMember(db *Database, username string, name string) (bool, error) {
+	res, err := db.Exec("DELETE FROM ListMember WHERE username=$1 AND list_id=(SELECT id FROM List WHERE name=$2)", username, name)
+	if err != nil {
+		return false, dbError(err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Change the role of a list member, returns false if they are not a member
+func updateListRole(db *Database, username string, name string, role string) (bool, error) {
+	res, err := db.Exec("UPDATE ListMember SET role=$3 WHERE username=$1 AND list_id=(SELECT id FROM List WHERE name=$2)", username, name, role)
+	if err != nil {
+		return false, dbError(err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Helper function to turn an error from the database into the kind of error it is:
+// lost connections are an *UnavailableError and broken constraints are a *ConflictError
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57":
+			return &UnavailableError{Err: err}
+		case "23":
+			return &ConflictError{Msg: pqErr.Message}
+		}
+		return err
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrCantOpen, sqlite3.ErrIoErr, sqlite3.ErrReadonly, sqlite3.ErrFull:
+			return &UnavailableError{Err: err}
+		case sqlite3.ErrConstraint:
+			return &ConflictError{Msg: err.Error()}
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.EOF) || errors.As(err, &netErr) {
+		return &UnavailableError{Err: err}
+	}
+	return err
+}
+
+// Helper function to quote a value in a connection string
+func connQuote(v string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(v, `\`, `\\`), "'", `\'`) + "'"
 }
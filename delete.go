@@ -1,23 +1,25 @@
 package main
 
-import (
-	"database/sql"
-	"fmt"
-	"os"
-	"strconv"
-)
+import "os"
 
-func finishItem(db *sql.DB) {
-	n := getDeleteIndex(true)
-	updateFinishItem(db, n)
+func finishItem(store Store) error {
+	n, err := getDeleteIndex(store, true)
+	if err != nil {
+		return err
+	}
+	return store.FinishItem(n)
 }
 
-func deleteItem(db *sql.DB) {
-	n := getDeleteIndex(true)
-	deleteItemDb(db, n)
+func deleteItem(store Store) error {
+	n, err := getDeleteIndex(store, false)
+	if err != nil {
+		return err
+	}
+	return store.DeleteItem(n)
 }
 
-func getDeleteIndex(finish bool) int {
+// Helper function to get the id of the item given on the command line, checking it exists
+func getDeleteIndex(store Store, finish bool) (int, error) {
 	// Get correct usage string
 	action := "delete"
 	if finish {
@@ -26,14 +28,12 @@ func getDeleteIndex(finish bool) int {
 
 	// Check for arguments
 	if len(os.Args) != 3 {
-		fmt.Fprintf(os.Stderr, "Usage: wtodo %s <id>\n", action)
-		os.Exit(0)
+		return 0, invalidInput("Usage: wtodo %s <id or name>", action)
 	}
-	n, err := strconv.Atoi(os.Args[2])
+	t, err := findItemArg(store, os.Args[2])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid ID!\n")
-		os.Exit(0)
+		return 0, err
 	}
 
-	return n
+	return t.Id, nil
 }
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Tables and the columns they have in the latest version of the schema made by createTables
+var schemaTables = []struct {
+	Name    string
+	Columns []string
+}{
+	{"Item", []string{"id", "name", "due", "start", "length", "priority", "finished", "owner", "list_id", "assignee", "created_at", "updated_at", "uuid"}},
+	{"Tag", []string{"item_id", "name"}},
+	{"ExternalId", []string{"source", "external_id", "item_id", "owner"}},
+	{"List", []string{"id", "name", "owner"}},
+	{"ListMember", []string{"list_id", "username", "role"}},
+	{"Comment", []string{"id", "item_id", "author", "created", "body"}},
+}
+
+// Most the clock of the database can be off from ours before due dates and sync times get confusing
+const MaxClockSkew = time.Minute
+
+// Result of one check made by wtodo doctor
+type doctorCheck struct {
+	Name   string
+	Detail string // Shown after the name when the check passes
+	Err    error  // Why the check failed, nil if it passed
+	Fix    string // What to do about a failed check
+}
+
+// Function to check that wtodo is set up correctly and its backend works,
+// printing what passed and failed with how to fix it
+// Exits with the code for the error of the first check that failed
+func doctorCommand() {
+	applyDisplay(DisplaySettings{})
+	var checks []doctorCheck
+	report := func(c doctorCheck) {
+		checks = append(checks, c)
+		printCheck(c)
+	}
+
+	// wtodo works without a config file when the database is given in the environment
+	settings, c := checkConfig()
+	if _, err := os.Stat(getConfigPath()); errors.Is(err, fs.ErrNotExist) && hasEnvDatabase() {
+		c = doctorCheck{Name: "Config file", Detail: "none, using the database from the environment"}
+		settings.Backend = PostgresBackend
+	}
+	report(c)
+	if c.Err != nil {
+		if !hasEnvDatabase() {
+			finishDoctor(checks)
+			return
+		}
+		settings.Backend = PostgresBackend
+	}
+	settings, err := resolveSettings(settings)
+	if err != nil {
+		report(doctorCheck{Name: "Database url", Err: err, Fix: "Fix the url given with --dsn, WTODO_DSN or DATABASE_URL"})
+		finishDoctor(checks)
+		return
+	}
+
+	switch settings.Backend {
+	case PostgresBackend:
+		report(checkReachable(settings.Database))
+		db, c := checkLogin(settings)
+		report(c)
+		if db == nil {
+			break
+		}
+		defer db.Close()
+		for _, c := range checkSchema(db) {
+			report(c)
+		}
+		report(checkClock(db))
+	case SqliteBackend:
+		path := getDataDir() + "/items.db"
+		if _, err := os.Stat(path); err != nil {
+			report(doctorCheck{Name: "SQLite database", Err: err, Fix: "Run wtodo list to make it"})
+			break
+		}
+		db, err := openSqlite(path)
+		if err != nil {
+			report(doctorCheck{Name: "SQLite database", Err: err, Fix: "Check the permissions of " + path})
+			break
+		}
+		defer db.Close()
+		report(doctorCheck{Name: "SQLite database", Detail: path})
+		for _, c := range checkSchema(db) {
+			report(c)
+		}
+		report(checkClock(nil))
+	case GitBackend:
+		if _, err := exec.LookPath("git"); err != nil {
+			report(doctorCheck{Name: "Git installed", Err: err, Fix: "Install git, or change the backend with wtodo setup"})
+		} else {
+			report(doctorCheck{Name: "Git installed"})
+		}
+		report(checkDataFile(getDataDir() + "/repo/items.json"))
+		report(checkClock(nil))
+	default:
+		report(checkDataFile(getDataDir() + "/items.json"))
+		report(checkClock(nil))
+	}
+	finishDoctor(checks)
+}
+
+// Helper function to print the result of a check
+func printCheck(c doctorCheck) {
+	if c.Err == nil {
+		detail := ""
+		if c.Detail != "" {
+			detail = fmt.Sprintf(" %s(%s)%s", GREY_C, c.Detail, RESET_C)
+		}
+		fmt.Printf("%s✔%s %s%s\n", LIGHT_GREEN_C, RESET_C, c.Name, detail)
+		return
+	}
+	fmt.Printf("%s✘%s %s: %s%v%s\n", LIGHT_RED_C, RESET_C, c.Name, RED_C, c.Err, RESET_C)
+	if c.Fix != "" {
+		fmt.Printf("  %sFix: %s%s\n", YELLOW_C, c.Fix, RESET_C)
+	}
+}
+
+// Helper function to print how many checks failed, exiting with the code for the first failure if any did
+func finishDoctor(checks []doctorCheck) {
+	failed := 0
+	var first error
+	for _, c := range checks {
+		if c.Err != nil {
+			failed++
+			if first == nil {
+				first = c.Err
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%s%d of %d checks failed%s\n", LIGHT_RED_C, failed, len(checks), RESET_C)
+		os.Exit(exitCode(first))
+	}
+	fmt.Printf("\n%sAll %d checks passed%s\n", LIGHT_GREEN_C, len(checks), RESET_C)
+}
+
+// Checks the config file can be read, returning the settings in it
+func checkConfig() (Settings, doctorCheck) {
+	path := getConfigPath()
+	c := doctorCheck{Name: "Config file", Detail: path}
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Err = invalidInput("%s does not exist", path)
+		c.Fix = "Run wtodo setup"
+		if _, err := os.Stat(getDataDir() + "/prefs.dat"); err == nil {
+			c.Fix = "Run wtodo list to move the settings in prefs.dat to the config file"
+		}
+		return Settings{Backend: FileBackend}, c
+	} else if err != nil {
+		c.Err = err
+		c.Fix = "Check the permissions of " + path
+		return Settings{Backend: FileBackend}, c
+	}
+
+	settings, err := parseConfig(content)
+	if err != nil {
+		c.Err = err
+		c.Fix = "Fix the JSON in " + path + " by hand, or move it away and run wtodo setup"
+		return Settings{Backend: FileBackend}, c
+	}
+	if settings.Username == "" {
+		c.Err = invalidInput("no username is set")
+		c.Fix = "Run wtodo setup"
+	}
+	return settings, c
+}
+
+// Checks the database server accepts connections, without logging in
+func checkReachable(db DatabaseSettings) doctorCheck {
+	network, address := "tcp", net.JoinHostPort(db.Host, strconv.Itoa(db.Port))
+	if strings.HasPrefix(db.Host, "/") {
+		network, address = "unix", fmt.Sprintf("%s/.s.PGSQL.%d", db.Host, db.Port)
+	}
+	c := doctorCheck{Name: "Database reachable", Detail: address}
+	conn, err := net.DialTimeout(network, address, 5*time.Second)
+	if err != nil {
+		c.Err = &UnavailableError{Err: err, Unreachable: true}
+		c.Fix = "Check that postgresql is running and database.host and database.port are right (wtodo config list)"
+		return c
+	}
+	conn.Close()
+	return c
+}
+
+// Checks wtodo can log in to the database, returning the connection if it could
+func checkLogin(settings Settings) (*Database, doctorCheck) {
+	c := doctorCheck{Name: "Database login", Detail: settings.Database.User + "@" + settings.Database.Name}
+	db, err := openDb(settings)
+	if err == nil {
+		return db, c
+	}
+
+	c.Err = err
+	c.Fix = "Check the database settings with wtodo config list"
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &pqErr) && (pqErr.Code == "28P01" || pqErr.Code == "28000"):
+		c.Fix = "Check database.user and the password (database.password, database.password_command or ~/.pgpass)"
+	case errors.As(err, &pqErr) && pqErr.Code == "3D000":
+		c.Fix = "Create the database with: createdb " + settings.Database.Name
+	case strings.Contains(err.Error(), "SSL") || strings.Contains(err.Error(), "certificate"):
+		c.Fix = "Check database.sslmode and the certificates in database.sslrootcert, database.sslcert and database.sslkey"
+	}
+	return nil, c
+}
+
+// Checks all tables exist with the columns of the latest schema, and that tags all belong to an item
+func checkSchema(db *Database) []doctorCheck {
+	tables := doctorCheck{Name: "Tables present"}
+	schema := doctorCheck{Name: "Table columns", Detail: "all present"}
+	var missingTables, missingColumns []string
+	for _, t := range schemaTables {
+		rows, err := db.Query("SELECT * FROM " + t.Name + " LIMIT 0;")
+		if err != nil {
+			missingTables = append(missingTables, t.Name)
+			continue
+		}
+		columns, _ := rows.Columns()
+		rows.Close()
+		for _, want := range t.Columns {
+			found := false
+			for _, col := range columns {
+				found = found || strings.EqualFold(col, want)
+			}
+			if !found {
+				missingColumns = append(missingColumns, t.Name+"."+want)
+			}
+		}
+	}
+
+	if len(missingTables) > 0 {
+		tables.Err = fmt.Errorf("missing %s", strings.Join(missingTables, ", "))
+		tables.Fix = "Run wtodo list to make them, as a database user that can create tables"
+		return []doctorCheck{tables}
+	}
+	tables.Detail = fmt.Sprintf("%d tables", len(schemaTables))
+	if len(missingColumns) > 0 {
+		schema.Err = fmt.Errorf("made by an older version of wtodo, missing %s", strings.Join(missingColumns, ", "))
+		schema.Fix = "Run wtodo list to update the tables, as a database user that can change them"
+	}
+	return []doctorCheck{tables, schema, checkTags(db), checkOwners(db)}
+}
+
+// Checks every tag belongs to an item and no item has the same tag twice
+func checkTags(db *Database) doctorCheck {
+	c := doctorCheck{Name: "Tag table integrity"}
+	var orphans, duplicates int
+	err := db.QueryRow("SELECT COUNT(*) FROM Tag t WHERE NOT EXISTS (SELECT 1 FROM Item i WHERE i.id=t.item_id);").Scan(&orphans)
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*) FROM (SELECT item_id, name FROM Tag GROUP BY item_id, name HAVING COUNT(*) > 1) d;").Scan(&duplicates)
+	}
+	if err != nil {
+		c.Err = err
+		return c
+	}
+
+	var problems, fixes []string
+	if orphans > 0 {
+		problems = append(problems, fmt.Sprintf("%d tags belong to items that no longer exist", orphans))
+		fixes = append(fixes, "DELETE FROM Tag WHERE item_id NOT IN (SELECT id FROM Item);")
+	}
+	if duplicates > 0 {
+		problems = append(problems, fmt.Sprintf("%d tags are on the same item more than once", duplicates))
+		fixes = append(fixes, "remove all but one row of each repeated tag")
+	}
+	if len(problems) > 0 {
+		c.Err = errors.New(strings.Join(problems, ", "))
+		c.Fix = "Run in the database: " + strings.Join(fixes, " and ")
+	}
+	return c
+}
+
+// Checks that every item has an owner, items from before items had owners are only seen once someone claims them
+func checkOwners(db *Database) doctorCheck {
+	c := doctorCheck{Name: "Item owners"}
+	n, err := countUnowned(db)
+	if err != nil {
+		c.Err = err
+	} else if n > 0 {
+		c.Err = fmt.Errorf("%d items from before items had owners belong to nobody", n)
+		c.Fix = "Run wtodo user claim as the user they belong to"
+	}
+	return c
+}
+
+// Checks the data file can be read, has no repeated ids and the last id given out is at least every item id
+func checkDataFile(path string) doctorCheck {
+	c := doctorCheck{Name: "Data file", Detail: path}
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Detail = path + " is made when the first item is added"
+		return c
+	} else if err != nil {
+		c.Err = err
+		c.Fix = "Check the permissions of " + path
+		return c
+	}
+
+	var data fileData
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		c.Err = fmt.Errorf("corrupted: %w", err)
+		c.Fix = "Restore it from a backup with wtodo restore, or fix the JSON by hand"
+		return c
+	}
+	seen := make(map[int]bool)
+	uuids := make(map[string]bool)
+	for _, it := range data.Items {
+		if it.Uuid != "" && uuids[it.Uuid] {
+			c.Err = fmt.Errorf("item UUID %s is used more than once", it.Uuid)
+			c.Fix = fmt.Sprintf("Remove the uuid of one of the items in %s, it is given a new one when wtodo is next run", path)
+			return c
+		}
+		uuids[it.Uuid] = true
+		if seen[it.Id] {
+			c.Err = fmt.Errorf("item id %d is used more than once", it.Id)
+			c.Fix = "Back up the items with wtodo backup and restore them with wtodo restore -replace to give them new ids"
+			return c
+		}
+		seen[it.Id] = true
+		if it.Id > data.NextId {
+			c.Err = fmt.Errorf("item id %d is after the last id given out (%d), so it could be given out again", it.Id, data.NextId)
+			c.Fix = fmt.Sprintf("Set next_id in %s to the largest item id", path)
+			return c
+		}
+	}
+	c.Detail = fmt.Sprintf("%s, %d items", path, len(data.Items))
+	return c
+}
+
+// Checks the clock of the database (if given) is close to ours, and shows the time zones used
+func checkClock(db *Database) doctorCheck {
+	zone, _ := time.Now().Zone()
+	c := doctorCheck{Name: "Clock and time zone", Detail: "local time zone " + zone}
+	if time.Local == time.UTC && os.Getenv("TZ") == "" {
+		c.Detail += ", set TZ if dates should be shown in another time zone"
+	}
+	if db == nil {
+		return c
+	}
+
+	var dbNow time.Time
+	var dbZone string
+	err := db.QueryRow("SELECT now(), current_setting('TimeZone');").Scan(&dbNow, &dbZone)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	skew := time.Since(dbNow)
+	if skew < 0 {
+		skew = -skew
+	}
+	c.Detail += ", database time zone " + dbZone
+	if skew > MaxClockSkew {
+		c.Err = fmt.Errorf("the database clock is %s off from this computer", skew.Round(time.Second))
+		c.Fix = "Sync the clocks with NTP, since items are ordered by when they were changed and due dates are compared to now"
+	}
+	return c
+}
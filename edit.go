@@ -2,11 +2,9 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"strconv"
@@ -14,28 +12,42 @@ import (
 	"time"
 )
 
-// Function to edit and add items
-func editItem(db *sql.DB, add bool) {
-	usageInfo := "Usage: wtodo " + os.Args[1] + " <id> [tags]"
+// Function to edit and add items, new items start with the default values from the config
+func editItem(store Store, defaults DefaultSettings, add bool) error {
+	usageInfo := "Usage: wtodo " + os.Args[1] + " <id or name> [tags]"
 
 	// Create and set default temp values
 	temp := Item{}
+	var err error
 	if add {
 		temp.Length = ShortTask
 		temp.Priority = 2
+		if defaults.Priority != 0 {
+			temp.Priority = defaults.Priority
+		}
+		if defaults.Length != "" {
+			temp.Length, err = parseLength(defaults.Length)
+			if err != nil {
+				return err
+			}
+		}
+		temp.List = defaults.List
 	}
 
 	// Maintain different usage info and store into new object if adding an item
-	// Otherwise, store the old object to edit in the temp variable if not using a database
+	// Otherwise, store the old object to edit in the temp variable if editing
 	if add {
 		usageInfo = "Usage: wtodo " + os.Args[1] + "[tags]"
 	} else {
-		temp = findItem(usageInfo, db)
+		temp, err = findItem(usageInfo, store)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Get flags for edit command
 	var p int
-	var l, d, s, name, t string
+	var l, d, s, name, t, list, assign string
 	var n bool
 	dateFormatSimple := "MMDDYYYY-HHmm, MMDD-HHmm, MMDDYYYY, MMDD, :HHmm, 0"
 	dateFormat := "Formats: MMDDYYYY-HHmm, MMDD-HHmm, MMDDYYYY, MMDD, :HHmm, 0 ([M]onth, [D]ate, [Y]ear, [H]our, [m]inute, 0=none) | Defaults: Today at 11:59pm"
@@ -47,6 +59,8 @@ func editItem(db *sql.DB, add bool) {
 	editFlags.BoolVar(&n, "en", false, "Edit name (only used if editing), enable flag to use text editor to edit todo item name")
 	editFlags.StringVar(&name, "n", "", "Name of the todo item, REQUIRED")
 	editFlags.StringVar(&t, "t", "", "Tags (Comma-seperated)")
+	editFlags.StringVar(&list, "list", "", "Shared list to put the item in, you must be a member | none to remove it from its list")
+	editFlags.StringVar(&assign, "assign", "", "Username to assign the item to | none to unassign it")
 
 	// Parse flags if there are any
 	if !add {
@@ -55,7 +69,10 @@ func editItem(db *sql.DB, add bool) {
 		editFlags.Parse(os.Args[2:])
 	} else {
 		// If there are no flags, run the interactive builder
-		interactiveAdd(&temp, dateFormatSimple)
+		err = interactiveAdd(&temp, dateFormatSimple)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Edit priority and check for the correct range of numbers
@@ -63,28 +80,39 @@ func editItem(db *sql.DB, add bool) {
 		if p > 0 && p <= 3 {
 			temp.Priority = p
 		} else {
-			fmt.Fprintln(os.Stderr, "Invalid Priority:", p, "\nPriority should be (1-3): 1 - high, 2 - normal, 3 - low")
-			os.Exit(1)
+			return invalidInput("Invalid Priority: %d\nPriority should be (1-3): 1 - high, 2 - normal, 3 - low", p)
 		}
 	}
 
 	// Edit length and check for the correct values
 	if l != "" {
-		temp.Length = parseLength(l)
+		temp.Length, err = parseLength(l)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Parse dates based on the avaliable formats
 	if d != "" {
-		temp.Due = parseDatetime(d, dateFormat)
+		temp.Due, err = parseDatetime(d, dateFormat)
+		if err != nil {
+			return err
+		}
 	}
 
 	if s != "" {
-		temp.Start = parseDatetime(d, dateFormat)
+		temp.Start, err = parseDatetime(d, dateFormat)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Edit name if tag enabled
 	if !add && n {
-		temp.Name = editName(temp.Name)
+		temp.Name, err = editName(temp.Name)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Edit tags if valid and not empty
@@ -92,50 +120,62 @@ func editItem(db *sql.DB, add bool) {
 		temp.Tags = strings.Split(t, ",")
 	}
 
+	// Move to a shared list if the user is a member of it
+	if list == "none" {
+		temp.List = ""
+	} else if list != "" {
+		member, err := isListMember(store, list)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return &NotFoundError{What: "list you are in", Name: list}
+		}
+		temp.List = list
+	}
+
+	// Edit who the item is assigned to
+	if assign == "none" {
+		temp.Assignee = ""
+	} else if assign != "" {
+		temp.Assignee = assign
+	}
+
 	// Name field is required for adding a todo
 	if len(os.Args) > 2 {
 		if add && name == "" {
-			fmt.Fprintln(os.Stderr, "Name field (-n) is required!")
-			os.Exit(1)
+			return invalidInput("Name field (-n) is required!")
 		} else if name != "" {
 			temp.Name = name
 		}
 	}
 
-	// Add or update from database
+	// Add or update in the store
 	if add {
-		insertItem(db, temp)
-	} else {
-		updateItem(db, temp)
+		_, err = store.InsertItem(temp)
+		return err
 	}
+	return store.UpdateItem(temp)
 }
 
-// Helper function to find an existing item in the database
-func findItem(usageInfo string, db *sql.DB) Item {
+// Helper function to find an existing item in the store
+func findItem(usageInfo string, store Store) (Item, error) {
 	// If it is an edit, find the item id and replace it
 	// Check for the ID command line argument
 	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, usageInfo)
-		os.Exit(1)
+		return Item{}, invalidInput(usageInfo)
 	}
 
-	// Select from database
-	key, _ := strconv.Atoi(os.Args[2])
-	item := selectItem(db, key)
-	// TODO: Add error if item is not found
-	return item
-
-	// // Error if not found
-	// log.Fatalln("ID not found:", os.Args[2], "\n", usageInfo)
-	// return 0, Item{}
+	// Check the item exists before asking for any changes
+	return findItemArg(store, os.Args[2])
 }
 
 // Helper function to edit the name of an Item using the default text editor
-func editName(oldName string) string {
+func editName(oldName string) (string, error) {
 	// Create temp file to edit the name of the Item
 	temp, err := os.CreateTemp("", "tmp")
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("Could not make a file to edit the name in: %w", err)
 	}
 	defer temp.Close()
 	defer os.Remove(temp.Name())
@@ -156,40 +196,37 @@ func editName(oldName string) string {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("Error running %s: %w", editor, err)
 	}
 
 	// Read the file that the user wrote to
 	// and save that data to the array
 	content, err := ioutil.ReadFile(temp.Name())
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("Could not read the edited name: %w", err)
 	}
 	line := strings.Split(string(content), "\n")[0]
-	return line
+	return line, nil
 }
 
 // Helper function to parse the string length to a TaskLength enum
-func parseLength(l string) TaskLength {
+func parseLength(l string) (TaskLength, error) {
 	switch l {
 	case "s", "short":
-		return ShortTask
+		return ShortTask, nil
 	case "m", "medium":
-		return MediumTask
+		return MediumTask, nil
 	case "l", "long":
-		return LongTask
-	default:
-		fmt.Fprintln(os.Stderr, "Invalid Length:", l, "\nLength should be [l]ong, [m]edium, [s]hort")
-		os.Exit(1)
+		return LongTask, nil
 	}
-	return ShortTask
+	return ShortTask, invalidInput("Invalid Length: %s\nLength should be [l]ong, [m]edium, [s]hort", l)
 }
 
 // Helper function to parse dates
-func parseDatetime(d string, dateFormat string) time.Time {
+func parseDatetime(d string, dateFormat string) (time.Time, error) {
 	// Return zero time if string empty
 	if d == "" || d == "0" {
-		return time.Time{}
+		return time.Time{}, nil
 	}
 
 	// Set defaults
@@ -203,8 +240,7 @@ func parseDatetime(d string, dateFormat string) time.Time {
 	// Parse time form input string
 	parsed, err := time.Parse(dateFormats[len(d)], d)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Invalid due date:", d, "|", dateFormat)
-		os.Exit(1)
+		return time.Time{}, invalidInput("Invalid due date: %s | %s", d, dateFormat)
 	}
 
 	// Modify defaults based on input string
@@ -229,10 +265,10 @@ func parseDatetime(d string, dateFormat string) time.Time {
 	}
 
 	// Return newly created date
-	return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+	return time.Date(year, month, day, hour, minute, 0, 0, time.Local), nil
 }
 
-func interactiveAdd(todo *Item, dateFormat string) {
+func interactiveAdd(todo *Item, dateFormat string) error {
 	read := bufio.NewReader(os.Stdin)
 	for todo.Name == "" {
 		fmt.Printf("%sEnter name %s[Required]%s ", YELLOW_C, GREY_C, RESET_C)
@@ -240,29 +276,37 @@ func interactiveAdd(todo *Item, dateFormat string) {
 		todo.Name = strings.Trim(name, " \n")
 	}
 
-	fmt.Printf("%sEnter priority %s(1 high, 2 normal, 3 low) [Default: 2]%s ", YELLOW_C, GREY_C, RESET_C)
+	// The item already has the default priority and length
+	defaultPriority := todo.Priority
+	fmt.Printf("%sEnter priority %s(1 high, 2 normal, 3 low) [Default: %d]%s ", YELLOW_C, GREY_C, defaultPriority, RESET_C)
 	priority, _ := read.ReadString('\n')
 	todo.Priority, _ = strconv.Atoi(priority[:len(priority)-1])
 	if priority == "\n" {
-		todo.Priority = 2
+		todo.Priority = defaultPriority
 	} else if todo.Priority < 1 || todo.Priority > 3 {
-		fmt.Printf("%sInvalid priority %d, defaulting to normal%s\n", RED_C, todo.Priority, RESET_C)
-		todo.Priority = 2
+		fmt.Printf("%sInvalid priority %d, defaulting to %d%s\n", RED_C, todo.Priority, defaultPriority, RESET_C)
+		todo.Priority = defaultPriority
 	}
 
-	fmt.Printf("%sEnter task length %s([s]hort, [m]edium, [l]ong) [Default: short]%s ", YELLOW_C, GREY_C, RESET_C)
+	fmt.Printf("%sEnter task length %s([s]hort, [m]edium, [l]ong) [Default: %s]%s ", YELLOW_C, GREY_C, strings.ToLower(lengthName(todo.Length)), RESET_C)
 	l, _ := read.ReadString('\n')
-	if l == "\n" {
-		todo.Length = ShortTask
-	} else {
-		todo.Length = parseLength(strings.Trim(l, "\n "))
+	var err error
+	if l != "\n" {
+		todo.Length, err = parseLength(strings.Trim(l, "\n "))
+		if err != nil {
+			return err
+		}
 	}
 
 	fmt.Printf("%sEnter due date %s(%s) [Default: none]%s ", YELLOW_C, GREY_C, dateFormat, RESET_C)
 	d, _ := read.ReadString('\n')
-	todo.Due = parseDatetime(d[:len(d)-1], dateFormat)
+	todo.Due, err = parseDatetime(d[:len(d)-1], dateFormat)
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("%sEnter start date %s(%s) [Default: none]%s ", YELLOW_C, GREY_C, dateFormat, RESET_C)
 	s, _ := read.ReadString('\n')
-	todo.Start = parseDatetime(s[:len(s)-1], dateFormat)
+	todo.Start, err = parseDatetime(s[:len(s)-1], dateFormat)
+	return err
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Exit codes for each kind of error, so scripts can tell them apart
+const (
+	ExitError       = 1 // Anything else
+	ExitInvalid     = 2 // Arguments or values that are missing or wrong
+	ExitUnavailable = 3 // The backend can't be reached or used
+	ExitNotFound    = 4 // There is no item or list with the id or name
+	ExitConflict    = 5 // The change clashes with something already there
+	ExitPermission  = 6 // The role of the user doesn't allow the change
+)
+
+// Returned when there is no item (or list) with an id or name the user can see
+// Suggestions are shown after the error, like items with close names
+type NotFoundError struct {
+	What        string
+	Id          int
+	Name        string
+	Suggestions []string
+}
+
+func (e *NotFoundError) Error() string {
+	msg := fmt.Sprintf("No such %s: %d", e.What, e.Id)
+	if e.Name != "" {
+		msg = fmt.Sprintf("No such %s: %s", e.What, e.Name)
+	}
+	if len(e.Suggestions) > 0 {
+		msg += "\nDid you mean:\n  " + strings.Join(e.Suggestions, "\n  ")
+	}
+	return msg
+}
+
+// Returned when arguments or values given by the user are wrong
+type InvalidInputError struct {
+	Msg string
+}
+
+func (e *InvalidInputError) Error() string {
+	return e.Msg
+}
+
+// Returned when the backend can't be reached or used
+// Unreachable is set when the server couldn't be connected to at all, rather than refusing the connection
+type UnavailableError struct {
+	Err         error
+	Unreachable bool
+}
+
+func (e *UnavailableError) Error() string {
+	return "Backend unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Returned when a change clashes with something already there, like a name that is taken
+type ConflictError struct {
+	Msg string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Msg
+}
+
+// Helper function to make an InvalidInputError
+func invalidInput(format string, a ...any) error {
+	return &InvalidInputError{Msg: fmt.Sprintf(format, a...)}
+}
+
+// Helper function to get the exit code for the kind of an error
+func exitCode(err error) int {
+	var notFound *NotFoundError
+	var invalid *InvalidInputError
+	var unavailable *UnavailableError
+	var conflict *ConflictError
+	var permission *PermissionError
+	switch {
+	case errors.As(err, &notFound):
+		return ExitNotFound
+	case errors.As(err, &invalid):
+		return ExitInvalid
+	case errors.As(err, &unavailable):
+		return ExitUnavailable
+	case errors.As(err, &conflict):
+		return ExitConflict
+	case errors.As(err, &permission):
+		return ExitPermission
+	}
+	return ExitError
+}
+
+// Helper function to print an error and exit with the code for its kind if there is one
+func checkError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s%s%s\n", LIGHT_RED_C, err, RESET_C)
+		os.Exit(exitCode(err))
+	}
+}
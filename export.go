@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Function to import items from another program
+func importItems(store Store) error {
+	usageInfo := "Usage: wtodo import -from <taskwarrior> [file]"
+
+	var from string
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	importFlags.StringVar(&from, "from", "", "Program the data is from | taskwarrior")
+	importFlags.Parse(os.Args[2:])
+
+	// Read the data from the file or stdin if no file is given
+	switch from {
+	case "taskwarrior":
+		data, err := readInput(importFlags.Arg(0))
+		if err != nil {
+			return err
+		}
+		added, updated, err := importTaskwarrior(store, data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sImported %d new and %d updated items from Taskwarrior%s\n", LIGHT_GREEN_C, added, updated, RESET_C)
+	default:
+		return invalidInput("Invalid import source: %s\n%s", from, usageInfo)
+	}
+	return nil
+}
+
+// Function to export items for another program
+func exportItems(store Store) error {
+	usageInfo := "Usage: wtodo export -format <md|org|taskwarrior> [file]"
+
+	var format string
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	exportFlags.StringVar(&format, "format", "", "Format of the exported data | md (markdown), org (org-mode), taskwarrior")
+	exportFlags.Parse(os.Args[2:])
+
+	// Write the data to the file or stdout if no file is given
+	var data []byte
+	var err error
+	switch format {
+	case "md", "markdown":
+		data, err = exportMarkdown(store)
+	case "org":
+		data, err = exportOrg(store)
+	case "taskwarrior":
+		data, err = exportTaskwarrior(store)
+	default:
+		return invalidInput("Invalid export format: %s\n%s", format, usageInfo)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(exportFlags.Arg(0), data)
+}
+
+// Helper function to read all data from a file, or stdin if the path is empty or "-"
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, invalidInput("No such file: %s", path)
+	}
+	return data, err
+}
+
+// Helper function to write data to a file, or stdout if the path is empty or "-"
+func writeOutput(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
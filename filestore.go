@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Store backed by a local JSON data file
+type fileStore struct {
+	path   string
+	user   string
+	data   fileData
+	filled bool // Items made by older versions were given UUIDs or creation dates when the file was loaded
+}
+
+// Contents of the data file
+type fileData struct {
+	NextId      int                       `json:"next_id"`
+	Items       []Item                    `json:"items"`
+	ExternalIds map[string]map[string]int `json:"external_ids"`
+	NextComment int                       `json:"next_comment"`
+	Comments    []Comment                 `json:"comments"`
+}
+
+// Loads the data file of a user at the given path, it is created on the first write
+func openFileStore(path string, username string) (*fileStore, error) {
+	s := &fileStore{path: path, user: username}
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, &UnavailableError{Err: fmt.Errorf("could not open data file: %w", err)}
+	}
+
+	err = json.Unmarshal(content, &s.data)
+	if err != nil {
+		return nil, &UnavailableError{Err: fmt.Errorf("data file is corrupted: %w", err)}
+	}
+
+	// Save the UUIDs and creation dates given to old items right away, so they stay the same
+	for i := range s.data.Items {
+		it := &s.data.Items[i]
+		if it.Uuid == "" {
+			it.Uuid, err = newUUID()
+			if err != nil {
+				return nil, err
+			}
+			s.filled = true
+		}
+		if it.Created.IsZero() {
+			it.Created = it.Updated
+			if it.Created.IsZero() {
+				it.Created = time.Now()
+			}
+			s.filled = true
+		}
+	}
+	if s.filled {
+		err = s.save()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Writes all data to the data file, replacing it only once fully written
+func (s *fileStore) save() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err == nil {
+		err = writeDataFile(s.path+".tmp", content)
+	}
+	if err == nil {
+		err = os.Rename(s.path+".tmp", s.path)
+	}
+	if err != nil {
+		return &UnavailableError{Err: fmt.Errorf("could not save data file: %w", err)}
+	}
+	return nil
+}
+
+// Helper function to find the index of an item, -1 if not found
+func (s *fileStore) find(id int) int {
+	for i, it := range s.data.Items {
+		if it.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *fileStore) SelectAll(finished bool) ([]Item, error) {
+	var temp []Item
+	for _, it := range s.data.Items {
+		if finished || !it.Finished {
+			it.Comments = s.countComments(it.Id)
+			temp = append(temp, it)
+		}
+	}
+	return temp, nil
+}
+
+func (s *fileStore) SelectItem(id int) (Item, error) {
+	i := s.find(id)
+	if i == -1 {
+		return Item{}, &NotFoundError{What: "item", Id: id}
+	}
+	it := s.data.Items[i]
+	it.Comments = s.countComments(id)
+	return it, nil
+}
+
+// The data file has a single user, so there are no permissions to check
+func (s *fileStore) InsertItem(item Item) (int, error) {
+	if item.Uuid == "" {
+		var err error
+		item.Uuid, err = newUUID()
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, it := range s.data.Items {
+		if it.Uuid == item.Uuid {
+			return 0, &ConflictError{Msg: "An item with the UUID " + item.Uuid + " already exists"}
+		}
+	}
+	s.data.NextId++
+	item.Id = s.data.NextId
+	item.Updated = time.Now()
+	if item.Created.IsZero() {
+		item.Created = item.Updated
+	}
+	s.data.Items = append(s.data.Items, item)
+	return item.Id, s.save()
+}
+
+func (s *fileStore) UpdateItem(item Item) error {
+	i := s.find(item.Id)
+	if i == -1 {
+		return &NotFoundError{What: "item", Id: item.Id}
+	}
+	item.Uuid = s.data.Items[i].Uuid
+	item.Created = s.data.Items[i].Created
+	item.Updated = time.Now()
+	s.data.Items[i] = item
+	return s.save()
+}
+
+func (s *fileStore) FinishItem(id int) error {
+	i := s.find(id)
+	if i == -1 {
+		return &NotFoundError{What: "item", Id: id}
+	}
+	s.data.Items[i].Finished = true
+	s.data.Items[i].Updated = time.Now()
+	return s.save()
+}
+
+func (s *fileStore) DeleteItem(id int) error {
+	i := s.find(id)
+	if i == -1 {
+		return &NotFoundError{What: "item", Id: id}
+	}
+	s.data.Items = append(s.data.Items[:i], s.data.Items[i+1:]...)
+
+	// Remove the comments on the item
+	var comments []Comment
+	for _, c := range s.data.Comments {
+		if c.ItemId != id {
+			comments = append(comments, c)
+		}
+	}
+	s.data.Comments = comments
+
+	// Remove the external ids that pointed to the item
+	for _, ids := range s.data.ExternalIds {
+		for externalId, itemId := range ids {
+			if itemId == id {
+				delete(ids, externalId)
+			}
+		}
+	}
+	return s.save()
+}
+
+func (s *fileStore) SelectExternalId(source string, externalId string) (int, error) {
+	return s.data.ExternalIds[source][externalId], nil
+}
+
+func (s *fileStore) SelectExternalIds(source string) (map[int]string, error) {
+	ids := make(map[int]string)
+	for externalId, id := range s.data.ExternalIds[source] {
+		ids[id] = externalId
+	}
+	return ids, nil
+}
+
+func (s *fileStore) InsertExternalId(source string, externalId string, id int) error {
+	if s.data.ExternalIds == nil {
+		s.data.ExternalIds = make(map[string]map[string]int)
+	}
+	if s.data.ExternalIds[source] == nil {
+		s.data.ExternalIds[source] = make(map[string]int)
+	}
+	s.data.ExternalIds[source][externalId] = id
+	return s.save()
+}
+
+// The data file only holds the items of the local user, so nothing has to move
+func (s *fileStore) RenameUser(newName string) error {
+	return nil
+}
+
+// Every item in the data file belongs to the local user
+func (s *fileStore) ClaimItems() (int, error) {
+	return 0, nil
+}
+
+// Shared lists only make sense when several users use the same database
+var errNoLists = invalidInput("Shared lists need a postgresql database, run wtodo setup to use one")
+
+func (s *fileStore) SelectLists() ([]TodoList, error) {
+	return nil, nil
+}
+
+func (s *fileStore) CreateList(name string) error {
+	return errNoLists
+}
+
+func (s *fileStore) JoinList(name string) error {
+	return errNoLists
+}
+
+func (s *fileStore) LeaveList(name string) error {
+	return errNoLists
+}
+
+func (s *fileStore) SetListRole(name string, username string, role string) error {
+	return errNoLists
+}
+
+func (s *fileStore) RemoveListMember(name string, username string) error {
+	return errNoLists
+}
+
+func (s *fileStore) SelectComments(id int) ([]Comment, error) {
+	if s.find(id) == -1 {
+		return nil, &NotFoundError{What: "item", Id: id}
+	}
+	var comments []Comment
+	for _, c := range s.data.Comments {
+		if c.ItemId == id {
+			comments = append(comments, c)
+		}
+	}
+	return comments, nil
+}
+
+func (s *fileStore) AddComment(c Comment) error {
+	c.Author = s.user
+	return s.RestoreComment(c)
+}
+
+// Adds a comment from a backup, keeping who wrote it and when
+func (s *fileStore) RestoreComment(c Comment) error {
+	if s.find(c.ItemId) == -1 {
+		return &NotFoundError{What: "item", Id: c.ItemId}
+	}
+	s.data.NextComment++
+	c.Id = s.data.NextComment
+	if c.Author == "" {
+		c.Author = s.user
+	}
+	s.data.Comments = append(s.data.Comments, c)
+	return s.save()
+}
+
+// Helper function to count the comments on an item
+func (s *fileStore) countComments(id int) int {
+	n := 0
+	for _, c := range s.data.Comments {
+		if c.ItemId == id {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fileStore) Close() {}
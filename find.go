@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Most items suggested when nothing matches what was given
+const MaxSuggestions = 3
+
+// Most items listed to choose from when several match a name
+const MaxChoices = 9
+
+// Shows and accepts short ids instead of item ids, set from display.short_ids
+var shortIds bool
+
+// Function to find the item given on the command line, by id, short id, UUID or name
+// Plain numbers are short ids when they are turned on, and #<id> is always the item id
+// A UUID can be shortened to its first 8 or more characters, as long as only one item starts with them
+// A name can be the whole name, the start of it or a part of it, the user picks one if several match
+// Names that are only close are never acted on, the error suggests them instead
+func findItemArg(store Store, arg string) (Item, error) {
+	arg = strings.TrimSpace(arg)
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	isId := err == nil && (strings.HasPrefix(arg, "#") || !shortIds)
+	if isId {
+		item, err := store.SelectItem(id)
+		var notFound *NotFoundError
+		if !errors.As(err, &notFound) {
+			return item, err
+		}
+	}
+
+	items, err := store.SelectAll(true)
+	if err != nil {
+		return Item{}, err
+	}
+	ids := shortIdMap(items)
+	notFound := &NotFoundError{What: "item", Name: arg}
+	if isId {
+		notFound = &NotFoundError{What: "item", Id: id}
+	} else if shortIds && isShortId(arg) {
+		for id, short := range ids {
+			if short == arg {
+				return store.SelectItem(id)
+			}
+		}
+	} else if matches := matchUuid(items, arg); len(matches) > 0 {
+		return chooseItem(matches, arg, ids)
+	} else if matches := matchName(items, arg); len(matches) > 0 {
+		return chooseItem(matches, arg, ids)
+	}
+
+	for i, it := range closeMatches(items, arg) {
+		if i == MaxSuggestions {
+			break
+		}
+		notFound.Suggestions = append(notFound.Suggestions, itemLabel(it, ids))
+	}
+	return Item{}, notFound
+}
+
+// Helper function to number the unfinished items from 1 in each shared list, in the order they were added
+// Items not in a list are numbered on their own, and items in a list get its name in front, like work:2
+// Numbers are given out again as items are finished, so they stay small
+func shortIdMap(items []Item) map[int]string {
+	var unfinished []Item
+	for _, it := range items {
+		if !it.Finished {
+			unfinished = append(unfinished, it)
+		}
+	}
+	sort.Slice(unfinished, func(p, q int) bool {
+		return unfinished[p].Id < unfinished[q].Id
+	})
+
+	ids := make(map[int]string)
+	counts := make(map[string]int)
+	for _, it := range unfinished {
+		counts[it.List]++
+		ids[it.Id] = strconv.Itoa(counts[it.List])
+		if it.List != "" {
+			ids[it.Id] = it.List + ":" + ids[it.Id]
+		}
+	}
+	return ids
+}
+
+// Helper function to check if text looks like a short id, a number with an optional list name in front
+func isShortId(text string) bool {
+	n := text[strings.LastIndex(text, ":")+1:]
+	_, err := strconv.Atoi(n)
+	return err == nil && !strings.HasPrefix(n, "-") && !strings.HasPrefix(n, "+")
+}
+
+// Helper function to get the id an item is shown with, its short id if they are turned on
+// Finished items have no short id, so they are shown with #<id>
+func displayId(t Item, ids map[int]string) string {
+	if !shortIds {
+		return strconv.Itoa(t.Id)
+	}
+	if short, ok := ids[t.Id]; ok {
+		return short
+	}
+	return "#" + strconv.Itoa(t.Id)
+}
+
+// Helper function to describe an item with the id it is shown with
+func itemLabel(t Item, ids map[int]string) string {
+	return fmt.Sprintf("%s. %s", displayId(t, ids), t.Name)
+}
+
+// Helper function to find the items with UUIDs starting with the text
+// Text shorter than 8 characters or with letters not in a UUID is left to match names
+func matchUuid(items []Item, text string) []Item {
+	text = strings.ToLower(text)
+	if len(text) < 8 || strings.Trim(text, "0123456789abcdef-") != "" {
+		return nil
+	}
+	var matches []Item
+	for _, it := range items {
+		if strings.HasPrefix(strings.ToLower(it.Uuid), text) {
+			matches = append(matches, it)
+		}
+	}
+	return matches
+}
+
+// Helper function to find the items with names matching the text best, trying unfinished items first
+func matchName(items []Item, text string) []Item {
+	var unfinished []Item
+	for _, it := range items {
+		if !it.Finished {
+			unfinished = append(unfinished, it)
+		}
+	}
+	for _, group := range [][]Item{unfinished, items} {
+		if matches := bestMatches(group, text); len(matches) > 0 {
+			return matches
+		}
+	}
+	return nil
+}
+
+// Helper function to find the items with names matching the text best
+// The whole name beats the start of a name, which beats a part of a name
+func bestMatches(items []Item, text string) []Item {
+	text = strings.ToLower(text)
+	tiers := []func(name string) bool{
+		func(name string) bool { return name == text },
+		func(name string) bool { return strings.HasPrefix(name, text) },
+		func(name string) bool { return strings.Contains(name, text) },
+	}
+	for _, tier := range tiers {
+		var matches []Item
+		for _, it := range items {
+			if tier(strings.ToLower(it.Name)) {
+				matches = append(matches, it)
+			}
+		}
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+	return nil
+}
+
+// Helper function to pick one of the items matching a name, asking the user if there are several
+// Without a terminal to ask in, the items are listed in the error instead
+func chooseItem(matches []Item, text string, ids map[int]string) (Item, error) {
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	var labels []string
+	for i, it := range matches {
+		if i == MaxChoices {
+			labels = append(labels, fmt.Sprintf("and %d more", len(matches)-MaxChoices))
+			break
+		}
+		labels = append(labels, itemLabel(it, ids))
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return Item{}, invalidInput("%d items match \"%s\", use the id of one:\n  %s", len(matches), text, strings.Join(labels, "\n  "))
+	}
+	fmt.Printf("%s%d items match \"%s\":%s\n", YELLOW_C, len(matches), text, RESET_C)
+	for i, label := range labels {
+		if i == MaxChoices {
+			fmt.Printf("  %s%s%s\n", GREY_C, label, RESET_C)
+			break
+		}
+		fmt.Printf("  %s%d)%s %s\n", WHITE_C, i+1, RESET_C, label)
+	}
+	choices := len(matches)
+	if choices > MaxChoices {
+		choices = MaxChoices
+	}
+	fmt.Printf("%sWhich one? %s(1-%d, Enter to cancel)%s ", YELLOW_C, GREY_C, choices, RESET_C)
+	line, _ := stdin.ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > choices {
+		return Item{}, invalidInput("No item was chosen")
+	}
+	return matches[n-1], nil
+}
+
+// Helper function to find the items with names close to the text, closest and unfinished items first
+func closeMatches(items []Item, text string) []Item {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return nil
+	}
+
+	// A typo every 3 letters is still close enough
+	maxDistance := len([]rune(text)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	var matches []Item
+	distances := make(map[int]int)
+	for _, it := range items {
+		d := nameDistance(strings.ToLower(it.Name), text)
+		if d <= maxDistance {
+			matches = append(matches, it)
+			distances[it.Id] = d
+		}
+	}
+	sort.SliceStable(matches, func(p, q int) bool {
+		if distances[matches[p].Id] != distances[matches[q].Id] {
+			return distances[matches[p].Id] < distances[matches[q].Id]
+		}
+		return !matches[p].Finished && matches[q].Finished
+	})
+	return matches
+}
+
+// Helper function to get how many edits the text is from the name or one of its words, 0 if the name contains it
+func nameDistance(name string, text string) int {
+	if strings.Contains(name, text) {
+		return 0
+	}
+	best := editDistance(name, text)
+	for _, word := range strings.Fields(name) {
+		if d := editDistance(word, text); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// Helper function to get the number of letters to add, remove or change to turn one string into another
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Store backed by a data file in a git repository, committing after every change
+// so the history can be looked at, diffed and pushed to any git remote
+type gitStore struct {
+	*fileStore
+	dir   string
+	dirty bool
+}
+
+// Opens the data file in the git repository at dir, making the repository if it does not exist
+func openGitStore(dir string, username string) (*gitStore, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, &UnavailableError{Err: errors.New("the git backend needs git to be installed")}
+	}
+	os.Mkdir(dir, fs.FileMode(0700))
+	file, err := openFileStore(dir+"/items.json", username)
+	if err != nil {
+		return nil, err
+	}
+	s := &gitStore{fileStore: file, dir: dir}
+	if _, err := os.Stat(dir + "/.git"); err != nil {
+		_, err = s.git("init", "-q")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if file.filled {
+		err = s.commit("Give items UUIDs and creation dates")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Helper function to run git in the repository, returning its output
+func (s *gitStore) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", s.dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", &UnavailableError{Err: fmt.Errorf("git %s failed: %s\n%s", args[0], err, out)}
+	}
+	return string(out), nil
+}
+
+// Commits the data file if it changed
+func (s *gitStore) commit(message string) error {
+	if _, err := os.Stat(s.path); err != nil {
+		return nil
+	}
+	_, err := s.git("add", "items.json")
+	if err != nil {
+		return err
+	}
+	status, err := s.git("status", "--porcelain", "items.json")
+	if err != nil || status == "" {
+		s.dirty = false
+		return err
+	}
+
+	// Use the wtodo username if git doesn't know who the user is
+	args := []string{"commit", "-q", "-m", message}
+	if out, _ := exec.Command("git", "-C", s.dir, "config", "user.email").Output(); len(out) == 0 {
+		args = append([]string{"-c", "user.name=" + s.user, "-c", "user.email=" + s.user + "@wtodo"}, args...)
+	}
+	_, err = s.git(args...)
+	if err == nil {
+		s.dirty = false
+	}
+	return err
+}
+
+// Helper function to describe an item in a commit message
+func describeCommit(id int, name string) string {
+	return fmt.Sprintf("item %d: %s", id, strings.TrimSpace(name))
+}
+
+func (s *gitStore) InsertItem(item Item) (int, error) {
+	id, err := s.fileStore.InsertItem(item)
+	if err != nil {
+		return id, err
+	}
+	return id, s.commit("Add " + describeCommit(id, item.Name))
+}
+
+func (s *gitStore) UpdateItem(item Item) error {
+	err := s.fileStore.UpdateItem(item)
+	if err != nil {
+		return err
+	}
+	return s.commit("Edit " + describeCommit(item.Id, item.Name))
+}
+
+func (s *gitStore) FinishItem(id int) error {
+	err := s.fileStore.FinishItem(id)
+	if err != nil {
+		return err
+	}
+	it, _ := s.SelectItem(id)
+	return s.commit("Finish " + describeCommit(id, it.Name))
+}
+
+func (s *gitStore) DeleteItem(id int) error {
+	it, _ := s.SelectItem(id)
+	err := s.fileStore.DeleteItem(id)
+	if err != nil {
+		return err
+	}
+	return s.commit("Delete " + describeCommit(id, it.Name))
+}
+
+func (s *gitStore) AddComment(c Comment) error {
+	err := s.fileStore.AddComment(c)
+	if err != nil {
+		return err
+	}
+	it, _ := s.SelectItem(c.ItemId)
+	return s.commit("Comment on " + describeCommit(c.ItemId, it.Name))
+}
+
+func (s *gitStore) RestoreComment(c Comment) error {
+	err := s.fileStore.RestoreComment(c)
+	if err != nil {
+		return err
+	}
+	it, _ := s.SelectItem(c.ItemId)
+	return s.commit("Restore comment on " + describeCommit(c.ItemId, it.Name))
+}
+
+// Ids from other programs are saved with the next change, so imports don't make a commit per id
+func (s *gitStore) InsertExternalId(source string, externalId string, id int) error {
+	err := s.fileStore.InsertExternalId(source, externalId, id)
+	s.dirty = true
+	return err
+}
+
+func (s *gitStore) Close() {
+	if s.dirty {
+		err := s.commit("Update ids from other programs")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	s.fileStore.Close()
+}
@@ -1,5 +1,12 @@
-module main
+module wtodo
 
 go 1.18
 
-require github.com/lib/pq v1.10.5
+require (
+	github.com/lib/pq v1.10.5
+	github.com/mattn/go-sqlite3 v1.14.19
+	golang.org/x/crypto v0.17.0
+	golang.org/x/term v0.15.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -2,108 +2,220 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
-	"log"
 	"os"
 	"strconv"
 	"strings"
+
+	"golang.org/x/term"
 )
 
+// Version of the config file, older versions used the positional prefs.dat file
+const ConfigVersion = 2
+
+// Contents of the config file
+type configFile struct {
+	Version int `json:"version"`
+	Settings
+}
+
+// Shared reader for prompts, so input read ahead by one prompt isn't lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// Loads the preferences from the user, asking for the passphrase if they are encrypted
+// Preferences from older versions are moved to the config file
+func loadPrefs(settings *Settings) error {
+	// Errors loading the config are shown with the default display settings
+	defer func() { applyDisplay(settings.Display) }()
+
+	content, err := readDataFile(getConfigPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return loadOldPrefs(settings)
+	} else if err != nil {
+		return err
+	}
+
+	*settings, err = parseConfig(content)
+	return err
+}
+
+// Reads the settings from the contents of the config file
+func parseConfig(content []byte) (Settings, error) {
+	var config configFile
+	err := json.Unmarshal(content, &config)
+	if err != nil {
+		return Settings{}, invalidInput("Config file is corrupted: %s", err)
+	}
+	if config.Version > ConfigVersion {
+		return Settings{}, invalidInput("Config file was made by a newer version of wtodo")
+	}
+	if config.Backend == "" {
+		config.Backend = FileBackend
+	}
+	return config.Settings, nil
+}
+
 /*
-PREFERENCES FILE FORMAT:
+OLD PREFERENCES FILE FORMAT (prefs.dat):
 
 <version>
 <username>
-<use database (0/1 - rest of fields required)>
-[db url (host)] [db port] [db username] [db password]
+<backend (0 - data file, 1 - database, rest of fields required, git - git repository, sqlite - sqlite database)>
+[db url (host)] [db port] [db username] [db password] [db name]
+
+Older versions didn't save the backend line, so the database line came right after the username
 */
 
-// Loads the preferences from the user
-func loadPrefs(settings *Settings) {
-	path := getDataFilePath()
+// Loads the preferences from prefs.dat if there is one, saving them to the config file
+func loadOldPrefs(settings *Settings) error {
+	settings.Backend = FileBackend
+	path := getDataDir() + "/prefs.dat"
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-	// Open data file
-	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0755)
-	if err != nil {
-		log.Fatal(err)
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if len(lines) < 2 || lines[0] == "" {
+		return nil
+	}
+	settings.Username = lines[1]
+
+	// The database line has at least 5 fields, so it can't be mistaken for the backend line
+	db := ""
+	if len(lines) > 2 {
+		switch lines[2] {
+		case "1":
+			settings.Backend = PostgresBackend
+			if len(lines) > 3 {
+				db = lines[3]
+			}
+		case GitBackend, SqliteBackend:
+			settings.Backend = lines[2]
+		case "0", "":
+		default:
+			settings.Backend = PostgresBackend
+			db = lines[2]
+		}
 	}
-	defer f.Close()
 
-	// Create scanner
-	scan := bufio.NewScanner(f)
-	scan.Split(bufio.ScanLines)
+	// Passwords could have spaces, so everything between the user and database name is the password
+	if settings.Backend == PostgresBackend {
+		ss := strings.Split(db, " ")
+		if len(ss) < 5 {
+			return invalidInput("Could not read the database settings in %s, run wtodo setup to enter them again", path)
+		}
+		settings.Database.Host = ss[0]
+		settings.Database.Port, _ = strconv.Atoi(ss[1])
+		settings.Database.User = ss[2]
+		settings.Database.Password = strings.Join(ss[3:len(ss)-1], " ")
+		settings.Database.Name = ss[len(ss)-1]
+	}
 
-	// Read the first line in the file
-	// If empty, then it is a new file! (return and don't do anything)
-	// Otherwise, it would be the version and we just ignore it
-	scan.Scan()
-	s := scan.Text()
-	if len(s) == 0 {
-		settings.UseDb = false
-		return
+	// Move the preferences to the config file, keeping the old file in case
+	err = savePrefs(settings)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path, path+".old")
+	if err != nil {
+		return fmt.Errorf("Could not move old preferences: %w", err)
 	}
+	fmt.Fprintf(os.Stderr, "%sMoved preferences to %s%s\n", GREY_C, getConfigPath(), RESET_C)
+	return nil
+}
 
-	// Read in the second line with the number data
-	scan.Scan()
-	settings.Username = scan.Text()
+// Saves the preferences for the user
+func savePrefs(settings *Settings) error {
+	content, err := json.MarshalIndent(configFile{Version: ConfigVersion, Settings: *settings}, "", "  ")
+	if err == nil {
+		// Write all the data to the file, encrypting it if encryption is turned on
+		err = writeDataFile(getConfigPath(), content)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save preferences: %w", err)
+	}
+	return nil
+}
 
-	// If this is false, don't continue
-	scan.Scan()
-	s = scan.Text()
-	settings.UseDb = s == "1"
-	if !settings.UseDb {
+// Turns colors off and short ids on if the display settings say so
+// By default colors are only shown in a terminal, and never if NO_COLOR is set
+func applyDisplay(display DisplaySettings) {
+	shortIds = display.ShortIds
+	switch display.Color {
+	case "always":
 		return
+	case "never":
+	default:
+		if os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+			return
+		}
 	}
+	for _, c := range []*string{&RESET_C, &RED_C, &YELLOW_C, &CYAN_C, &GREY_C, &WHITE_C, &DARK_GREY_C, &LIGHT_RED_C, &LIGHT_GREEN_C, &TITLE0_C, &TITLE1_C, &DATE0_C, &DATE1_C, &DATE2_C, &DATE3_C, &RATE0_C, &RATE1_C, &RATE2_C} {
+		*c = ""
+	}
+}
 
-	// Read in the rest of the lines
-	scan.Scan()
-	s = scan.Text()
-	ss := strings.Split(s, " ")
-	settings.DbHost = ss[0]
-	settings.DbPort, _ = strconv.Atoi(ss[1])
-	settings.DbUser = ss[2]
-	settings.DbPass = ss[3]
-	settings.DbName = ss[4]
+// Helper function to get the path of the config file, from --config or WTODO_CONFIG if given
+func getConfigPath() string {
+	if path := optionOrEnv(options.Config, "WTODO_CONFIG"); path != "" {
+		return path
+	}
+	return getDataDir() + "/config.json"
 }
 
-// Saves the preferences for the user
-func savePrefs(settings *Settings) {
-	// Instantiate the stringbuilder
-	sb := strings.Builder{}
-
-	// Write the version on the first line
-	sb.WriteString(Version)
-	sb.WriteString("\n")
-
-	// Save the username and useDb boolean var on the next 2 lines
-	sb.WriteString(settings.Username)
-	sb.WriteString("\n")
-
-	// If database is used, save the info for the database
-	if settings.UseDb {
-		sb.WriteString(settings.DbHost)
-		sb.WriteString(" ")
-		sb.WriteString(strconv.Itoa(settings.DbPort))
-		sb.WriteString(" ")
-		sb.WriteString(settings.DbUser)
-		sb.WriteString(" ")
-		sb.WriteString(settings.DbPass)
-		sb.WriteString(" ")
-		sb.WriteString(settings.DbName)
-	}
-
-	// Write all the data to the file
-	os.WriteFile(getDataFilePath(), []byte(sb.String()), fs.FileMode(os.O_TRUNC))
+// Helper function to get the data directory, making it if it does not exist
+// Each profile has its own directory inside it
+func getDataDir() string {
+	dir := getBaseDir()
+	if profile := currentProfile(); profile != DefaultProfile {
+		dir += "/profiles/" + profile
+		os.MkdirAll(dir, fs.FileMode(0700))
+	}
+	return dir
 }
 
-// Helper function to get the path of the data file
-func getDataFilePath() string {
-	// Get home file path and make data dir if not exists
+// Directory all profiles are kept in and the profile to use, found by findDirs when wtodo starts
+var baseDir string
+var profileName string
+
+// Finds the directory all profiles are kept in, making it if it does not exist, and the profile to use,
+// from --profile, WTODO_PROFILE or the one chosen with wtodo profile use
+func findDirs() error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatal(err)
+		return invalidInput("Could not find your home directory: %s", err)
+	}
+	baseDir = homeDir + "/.wtodo"
+	os.Mkdir(baseDir, fs.FileMode(0755))
+
+	profileName = optionOrEnv(options.Profile, "WTODO_PROFILE")
+	if profileName == "" {
+		content, _ := os.ReadFile(baseDir + "/profile")
+		profileName = strings.TrimSpace(string(content))
+		if profileName != "" && !validProfileName(profileName) {
+			return invalidInput("Invalid profile name in %s/profile: %s, choose another with wtodo --profile default profile use <name>", baseDir, profileName)
+		}
 	}
-	path := homeDir + "/.wtodo/prefs.dat"
-	os.Mkdir(homeDir+"/.wtodo", fs.FileMode(0755))
-	return path
+	if profileName == "" {
+		profileName = DefaultProfile
+	} else if !validProfileName(profileName) {
+		return invalidInput("Invalid profile name: %s", profileName)
+	}
+	return nil
+}
+
+// Helper function to get the directory all profiles are kept in
+func getBaseDir() string {
+	return baseDir
+}
+
+// Gets the profile to use
+func currentProfile() string {
+	return profileName
 }
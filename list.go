@@ -1,17 +1,87 @@
 package main
 
 import (
-	"database/sql"
+	"flag"
 	"fmt"
 	"sort"
 	"strings"
 	"time"
 )
 
+// Filters that can be applied when listing items
+type ListFilter struct {
+	Completed    bool
+	Tag          string
+	List         string
+	Mine         bool
+	AssignedByMe bool
+	User         string
+}
+
+// Parses the list filters for a user from the command line arguments
+func parseListFilter(args []string, username string) ListFilter {
+	filter := ListFilter{User: username}
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	listFlags.BoolVar(&filter.Completed, "c", false, "Show completed items instead of the items left to do")
+	listFlags.BoolVar(&filter.Completed, "completed", false, "Same as -c")
+	listFlags.StringVar(&filter.Tag, "t", "", "Only show items with this tag")
+	listFlags.StringVar(&filter.List, "list", "", "Only show items in this shared list")
+	listFlags.BoolVar(&filter.Mine, "mine", false, "Only show items assigned to you, or your own items that aren't assigned")
+	listFlags.BoolVar(&filter.AssignedByMe, "assigned-by-me", false, "Only show your items that are assigned to someone else")
+	listFlags.Parse(args)
+	return filter
+}
+
+// Helper function to only keep the items matching a filter
+// Finished items are kept only if the filter is for completed items
+func (f ListFilter) apply(todos []Item) []Item {
+	var temp []Item
+	for _, t := range todos {
+		if t.Finished != f.Completed {
+			continue
+		}
+		if f.Tag != "" && !hasTag(t, f.Tag) {
+			continue
+		}
+		if f.List != "" && t.List != f.List {
+			continue
+		}
+		if f.Mine && t.Assignee != f.User && (t.Assignee != "" || t.Owner != f.User) {
+			continue
+		}
+		if f.AssignedByMe && (t.Owner != f.User || t.Assignee == "" || t.Assignee == f.User) {
+			continue
+		}
+		temp = append(temp, t)
+	}
+	return temp
+}
+
+// Helper function to check if an item has a tag
+func hasTag(t Item, tag string) bool {
+	for _, tt := range t.Tags {
+		if strings.EqualFold(tt, tag) {
+			return true
+		}
+	}
+	return false
+}
+
 // Function to list all items
-func list(db *sql.DB) {
-	// Get all data from database
-	todos := selectAll(db)
+func list(store Store, filter ListFilter) error {
+	// Get all data from the store
+	all, err := store.SelectAll(filter.Completed)
+	if err != nil {
+		return err
+	}
+	todos := filter.apply(all)
+	ids := shortIdMap(all)
+
+	// Completed items are shown in their own list
+	if filter.Completed {
+		listCompleted(todos, ids)
+		return nil
+	}
 
 	// Filter list by done and not done
 	notDone, _ := filterItems(todos)
@@ -19,11 +89,15 @@ func list(db *sql.DB) {
 	// Print header
 	currDate := time.Now().Format("Monday January 2, 2006 (1/2/06) 3:04pm")
 	fmt.Printf("%s⬤ %s%s%d Items To Do %s❚ %s%s%s%s ⬤%s\n", WHITE_C, RESET_C, TITLE0_C, len(notDone), WHITE_C, RESET_C, TITLE1_C, currDate, WHITE_C, RESET_C)
+	err = printUnowned(store)
+	if err != nil {
+		return err
+	}
 
 	// If no items, print message and exit
 	if len(notDone) == 0 {
 		fmt.Printf("%sNothing left to do! Use %s%swtodo add%s%s to add more items.%s\n\n", WHITE_C, RESET_C, GREY_C, RESET_C, WHITE_C, RESET_C)
-		return
+		return nil
 	}
 
 	// Filter each section by how far it is from due (<1 day, <1 week, other)
@@ -33,31 +107,65 @@ func list(db *sql.DB) {
 	if len(late) > 0 {
 		fmt.Printf("%sOVERDUE%s\n", GREY_C, RESET_C)
 		for _, t := range late {
-			printListItem(t, 0)
+			printListItem(t, displayId(t, ids), 0)
 		}
 	}
 
 	if len(today) > 0 {
 		fmt.Printf("\n%sDO TODAY%s\n", GREY_C, RESET_C)
 		for _, t := range today {
-			printListItem(t, 1)
+			printListItem(t, displayId(t, ids), 1)
 		}
 	}
 
 	if len(soon) > 0 {
 		fmt.Printf("\n%sDO SOON%s\n", GREY_C, RESET_C)
 		for _, t := range soon {
-			printListItem(t, 2)
+			printListItem(t, displayId(t, ids), 2)
 		}
 	}
 
 	if len(later) > 0 {
 		fmt.Printf("\n%sDO LATER (>1 week)%s\n", GREY_C, RESET_C)
 		for _, t := range later {
-			printListItem(t, 3)
+			printListItem(t, displayId(t, ids), 3)
 		}
 	}
 	println()
+	return nil
+}
+
+// Stores that can have items from before items had owners
+type unownedCounter interface {
+	unowned() (int, error)
+}
+
+// Helper function to point to wtodo user claim while there are items nobody owns, as nobody sees them
+func printUnowned(store Store) error {
+	counter, ok := store.(unownedCounter)
+	if !ok {
+		return nil
+	}
+	n, err := counter.unowned()
+	if err != nil || n == 0 {
+		return err
+	}
+	fmt.Printf("%s%d items from before items had owners are hidden, run %s%swtodo user claim%s%s if they are yours%s\n", YELLOW_C, n, RESET_C, GREY_C, RESET_C, YELLOW_C, RESET_C)
+	return nil
+}
+
+// Function to list completed items, most recently due first
+func listCompleted(done []Item, ids map[int]string) {
+	currDate := time.Now().Format("Monday January 2, 2006 (1/2/06) 3:04pm")
+	fmt.Printf("%s⬤ %s%s%d Items Completed %s❚ %s%s%s%s ⬤%s\n", WHITE_C, RESET_C, TITLE0_C, len(done), WHITE_C, RESET_C, TITLE1_C, currDate, WHITE_C, RESET_C)
+
+	sort.Slice(done, func(p, q int) bool {
+		return done[p].Due.After(done[q].Due)
+	})
+	for _, t := range done {
+		printListItem(t, displayId(t, ids), 3)
+	}
+	println()
 }
 
 // Helper function to filter todos
@@ -116,11 +224,11 @@ func dateSortItems(todos []Item) (late []Item, today []Item, soon []Item, later
 
 // Helper function to display one todo item
 // Severity = 0 - red bold, 1 - red, 2 - yellow, 3 - green
-func printListItem(t Item, severity int) {
+func printListItem(t Item, id string, severity int) {
 	dueWidth := "21"
 	nameWidth := "30"
 	due := t.Due.Format("Mon 1/2/06 3:04pm")
-	var dateCol, priorityCol, length string
+	var dateCol, priorityCol string
 
 	// Date color
 	switch severity {
@@ -139,16 +247,6 @@ func printListItem(t Item, severity int) {
 		dateCol = DATE3_C
 	}
 
-	// Length calculation
-	switch t.Length {
-	case LongTask:
-		length = "L"
-	case MediumTask:
-		length = "M"
-	default:
-		length = "S"
-	}
-
 	// Priority color
 	switch t.Priority {
 	case 1:
@@ -160,7 +258,14 @@ func printListItem(t Item, severity int) {
 	}
 
 	// Calculate all other values
+	length := lengthLetter(t.Length)
 	tags := strings.Join(t.Tags, ",")
+	if t.Assignee != "" {
+		tags = strings.TrimSpace("@" + t.Assignee + " " + tags)
+	}
+	if t.List != "" {
+		tags = strings.TrimSpace("[" + t.List + "] " + tags)
+	}
 	name := t.Name
 	if len(name) > 50 {
 		name = fmt.Sprintf("%s... (%s)", name[:47], length)
@@ -168,8 +273,12 @@ func printListItem(t Item, severity int) {
 		name = fmt.Sprintf("%s (%s)", name, length)
 	}
 	priority := strings.Repeat("!", t.Priority)
+	comments := ""
+	if t.Comments > 0 {
+		comments = fmt.Sprintf(" 💬%d", t.Comments)
+	}
 
 	// Format and print
-	format := "%s%7d. %s%s%-" + dueWidth + "s%s%-3s %s%s%-" + nameWidth + "s%s %s%s%s\n"
-	fmt.Printf(format, DARK_GREY_C, t.Id, RESET_C, dateCol, due, priorityCol, priority, RESET_C, WHITE_C, name, RESET_C, GREY_C, tags, RESET_C)
+	format := "%s%7s. %s%s%-" + dueWidth + "s%s%-3s %s%s%-" + nameWidth + "s%s %s%s%s%s%s%s\n"
+	fmt.Printf(format, DARK_GREY_C, id, RESET_C, dateCol, due, priorityCol, priority, RESET_C, WHITE_C, name, RESET_C, GREY_C, tags, RESET_C, TITLE1_C, comments, RESET_C)
 }
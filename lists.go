@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Function to show and manage the shared lists of the user
+func listsCommand(store Store) error {
+	usageInfo := "Usage: wtodo lists [create|join|leave <name>] [role <name> <username> <owner|editor|viewer>] [remove <name> <username>]"
+
+	// With no action, show the lists the user is in
+	if len(os.Args) == 2 {
+		return showLists(store)
+	}
+	if len(os.Args) < 4 {
+		return invalidInput(usageInfo)
+	}
+
+	name := os.Args[3]
+	switch os.Args[2] {
+	case "create", "join", "leave":
+		if len(os.Args) != 4 {
+			return invalidInput(usageInfo)
+		}
+	}
+
+	switch os.Args[2] {
+	case "create":
+		if name == "" || name == "none" || strings.ContainsAny(name, " \t\n") || len(name) > 50 {
+			return invalidInput("Invalid list name: %s\nList names can't be empty, \"none\", have spaces or be longer than 50 characters", name)
+		}
+		err := store.CreateList(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sCreated list %s, others can join with %swtodo lists join %s%s\n", LIGHT_GREEN_C, name, GREY_C, name, RESET_C)
+	case "join":
+		err := store.JoinList(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sJoined list %s%s\n", LIGHT_GREEN_C, name, RESET_C)
+	case "leave":
+		err := store.LeaveList(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sLeft list %s%s\n", LIGHT_GREEN_C, name, RESET_C)
+	case "role":
+		if len(os.Args) != 6 || !validRole(os.Args[5]) {
+			return invalidInput("Usage: wtodo lists role <name> <username> <owner|editor|viewer>")
+		}
+		err := store.SetListRole(name, os.Args[4], os.Args[5])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s%s is now a %s of %s%s\n", LIGHT_GREEN_C, os.Args[4], os.Args[5], name, RESET_C)
+	case "remove":
+		if len(os.Args) != 5 {
+			return invalidInput("Usage: wtodo lists remove <name> <username>")
+		}
+		err := store.RemoveListMember(name, os.Args[4])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sRemoved %s from %s%s\n", LIGHT_GREEN_C, os.Args[4], name, RESET_C)
+	default:
+		return invalidInput("Invalid lists action: %s\n%s", os.Args[2], usageInfo)
+	}
+	return nil
+}
+
+// Prints the lists the user is a member of
+func showLists(store Store) error {
+	lists, err := store.SelectLists()
+	if err != nil {
+		return err
+	}
+	if len(lists) == 0 {
+		fmt.Printf("%sNot in any lists! Use %s%swtodo lists create <name>%s%s to make one.%s\n", WHITE_C, RESET_C, GREY_C, RESET_C, WHITE_C, RESET_C)
+		return nil
+	}
+	for _, l := range lists {
+		members := make([]string, len(l.Members))
+		for i, m := range l.Members {
+			members[i] = m.Username + " (" + m.Role + ")"
+		}
+		fmt.Printf("%s%-20s%s %screated by %s | members: %s%s\n", WHITE_C, l.Name, RESET_C, GREY_C, l.Owner, strings.Join(members, ", "), RESET_C)
+	}
+	return nil
+}
+
+// Helper function to check if the user is a member of a list
+func isListMember(store Store, name string) (bool, error) {
+	lists, err := store.SelectLists()
+	if err != nil {
+		return false, err
+	}
+	for _, l := range lists {
+		if l.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
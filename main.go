@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"math/rand"
 	"os"
@@ -9,11 +8,6 @@ import (
 	"time"
 )
 
-// Just in case we have a version update that breaks the data file
-// this version is written to the top of the data file to be compared
-// Currently, this value is IGNORED
-const Version = "1"
-
 // Date mappings
 var dateFormats = map[int]string{
 	4:  "0102",
@@ -23,25 +17,27 @@ var dateFormats = map[int]string{
 	13: "01022006-1504",
 }
 
-// Color mappings
-const RESET_C = "\033[0m"
-const RED_C = "\033[31m"
-const YELLOW_C = "\033[33m" // More gold-like
-const CYAN_C = "\033[36m"   // Really bright blue
-const GREY_C = "\033[37m"
-const WHITE_C = "\033[1;37m"
-const DARK_GREY_C = "\033[1;30m"
-const LIGHT_RED_C = "\033[1;31m"
-const LIGHT_GREEN_C = "\033[1;32m"
-const TITLE0_C = "\033[38;5;225m"
-const TITLE1_C = "\033[38;5;159m"
-const DATE0_C = "\033[38;5;124m"
-const DATE1_C = "\033[38;5;203m"
-const DATE2_C = "\033[38;5;222m"
-const DATE3_C = "\033[38;5;192m"
-const RATE0_C = "\033[38;5;157m"
-const RATE1_C = "\033[38;5;229m"
-const RATE2_C = "\033[38;5;215m"
+// Color mappings, cleared when colors are turned off
+var (
+	RESET_C       = "\033[0m"
+	RED_C         = "\033[31m"
+	YELLOW_C      = "\033[33m" // More gold-like
+	CYAN_C        = "\033[36m" // Really bright blue
+	GREY_C        = "\033[37m"
+	WHITE_C       = "\033[1;37m"
+	DARK_GREY_C   = "\033[1;30m"
+	LIGHT_RED_C   = "\033[1;31m"
+	LIGHT_GREEN_C = "\033[1;32m"
+	TITLE0_C      = "\033[38;5;225m"
+	TITLE1_C      = "\033[38;5;159m"
+	DATE0_C       = "\033[38;5;124m"
+	DATE1_C       = "\033[38;5;203m"
+	DATE2_C       = "\033[38;5;222m"
+	DATE3_C       = "\033[38;5;192m"
+	RATE0_C       = "\033[38;5;157m"
+	RATE1_C       = "\033[38;5;229m"
+	RATE2_C       = "\033[38;5;215m"
+)
 
 type TaskLength int
 
@@ -52,104 +48,262 @@ const (
 )
 
 type Item struct {
-	Id       int
-	Name     string
-	Due      time.Time
-	Start    time.Time
-	Length   TaskLength
-	Priority int
-	Finished bool
-	Tags     []string
+	Id       int        `json:"id"`
+	Uuid     string     `json:"uuid"` // Given when the item is made and never changed, unlike the id it is unique across databases
+	Name     string     `json:"name"`
+	Due      time.Time  `json:"due"`
+	Start    time.Time  `json:"start"`
+	Length   TaskLength `json:"length"`
+	Priority int        `json:"priority"`
+	Finished bool       `json:"finished"`
+	Tags     []string   `json:"tags"`
+	Owner    string     `json:"owner,omitempty"`
+	List     string     `json:"list,omitempty"`
+	Assignee string     `json:"assignee,omitempty"`
+	Comments int        `json:"comments"`
+	Created  time.Time  `json:"created"` // When the item was first added, kept when it is restored, synced or imported
+	Updated  time.Time  `json:"updated"`
 }
 
+// A comment left on an item
+type Comment struct {
+	Id      int       `json:"id"`
+	ItemId  int       `json:"item_id"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+	Body    string    `json:"body"`
+}
+
+// A list shared between users
+type TodoList struct {
+	Name    string       `json:"name"`
+	Owner   string       `json:"owner"`
+	Members []ListMember `json:"members"`
+}
+
+// A user in a shared list and their role (owner, editor or viewer)
+type ListMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Settings saved in the config file
 type Settings struct {
-	UseDb    bool
-	DbHost   string
-	DbPort   int
-	DbUser   string
-	DbPass   string
-	DbName   string
-	Username string
+	Username string           `json:"username"`
+	Backend  string           `json:"backend"`
+	Database DatabaseSettings `json:"database"`
+	Display  DisplaySettings  `json:"display"`
+	Defaults DefaultSettings  `json:"defaults"`
+}
+
+// Connection to the postgresql database
+// The host can also be the directory of a unix socket, and the password can come from a command or ~/.pgpass
+type DatabaseSettings struct {
+	Host            string `json:"host"`
+	Port            int    `json:"port"`
+	User            string `json:"user"`
+	Password        string `json:"password"`
+	PasswordCommand string `json:"password_command"`
+	Name            string `json:"name"`
+	SSLMode         string `json:"sslmode"`
+	SSLRootCert     string `json:"sslrootcert"`
+	SSLCert         string `json:"sslcert"`
+	SSLKey          string `json:"sslkey"`
+}
+
+// How items are shown
+type DisplaySettings struct {
+	Color    string `json:"color"`     // auto (only in a terminal), always or never
+	ShortIds bool   `json:"short_ids"` // Number items from 1 in each list instead of showing their ids
+}
+
+// Values used for new items when they aren't given
+type DefaultSettings struct {
+	Priority int    `json:"priority"`
+	Length   string `json:"length"`
+	List     string `json:"list"`
 }
 
 // Command: wtodo <action> [tags] <text>
 func main() {
 	// Define list and main id incrementer
 	var settings Settings
-	var db *sql.DB
+
+	// Read the options before the action, they change where the config is loaded from
+	err := parseOptions()
+	if err != nil {
+		applyDisplay(DisplaySettings{})
+		checkError(err)
+	}
+
+	// Profiles are managed before any of them is loaded
+	if len(os.Args[1:]) > 0 && os.Args[1] == "profile" {
+		checkError(profileCommand())
+		return
+	}
+
+	// Doctor reads the config itself, so it can report problems loading it
+	if len(os.Args[1:]) > 0 && os.Args[1] == "doctor" {
+		doctorCommand()
+		return
+	}
+
+	// Setup with options doesn't ask anything, so it runs before a username is made
+	// It can also repair a config that can't be loaded, by starting over
+	if len(os.Args[1:]) > 1 && (os.Args[1] == "s" || os.Args[1] == "setup") {
+		err = loadPrefs(&settings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s%s, starting over%s\n", YELLOW_C, err, RESET_C)
+			settings = Settings{}
+		}
+		checkError(setupCommand(&settings))
+		return
+	}
 
 	// Load preferences from file
-	loadPrefs(&settings)
+	checkError(loadPrefs(&settings))
 
 	// If first time using system, generate a username
-	setup(&settings, false)
+	checkError(setup(&settings, false))
 
 	// If user wants to re-run the setup, do it before loading data
 	if len(os.Args[1:]) > 0 && (os.Args[1] == "s" || os.Args[1] == "setup") {
-		setup(&settings, true)
+		checkError(setup(&settings, true))
+	}
+
+	// The config can be changed without opening the store, which might not work until it is fixed
+	if len(os.Args[1:]) > 0 && os.Args[1] == "config" {
+		checkError(configCommand(&settings))
+		return
 	}
 
-	// Load data from database
-	db = connectDb(settings)
-	defer db.Close()
+	// Environment variables and options override the database in the config file from here on,
+	// commands that save the config change the settings loaded from the file instead
+	saved := settings
+	settings, err = resolveSettings(settings)
+	checkError(err)
+
+	// Load data from the database or data file
+	store, err := openStore(settings)
+	checkError(err)
 
 	// Case where there are no command line arguments
 	if len(os.Args[1:]) < 1 {
-		list(db)
+		err = list(store, ListFilter{})
+		store.Close()
+		checkError(err)
 		return
 	}
 
 	// Run commands based on the action statement
 	switch os.Args[1] {
-	case "list", "l", "setup", "s":
-		list(db)
+	case "list", "l":
+		err = list(store, parseListFilter(os.Args[2:], settings.Username))
+	case "setup", "s":
+		err = list(store, ListFilter{})
 	case "add", "insert", "a", "i":
-		editItem(db, true)
+		err = editItem(store, settings.Defaults, true)
 	case "edit", "e":
-		editItem(db, false)
+		err = editItem(store, settings.Defaults, false)
 	case "finish", "f":
-		finishItem(db)
+		err = finishItem(store)
 	case "delete", "d":
-		deleteItem(db)
+		err = deleteItem(store)
+	case "show":
+		err = showItem(store)
+	case "comment":
+		err = commentItem(store)
+	case "import":
+		err = importItems(store)
+	case "export":
+		err = exportItems(store)
+	case "backup":
+		err = backupItems(store, settings)
+	case "restore":
+		err = restoreItems(store, &saved)
+	case "sync":
+		err = syncCommand(store, settings)
+	case "watch", "w":
+		err = watch(store, ListFilter{User: settings.Username})
+	case "lists":
+		err = listsCommand(store)
+	case "serve":
+		err = serve(store, settings.Username)
+	case "encrypt":
+		err = encryptCommand(settings)
+	case "decrypt":
+		err = decryptCommand()
+	case "whoami":
+		whoami(settings)
+	case "user":
+		err = userCommand(store, &saved)
 	default:
-		fmt.Printf("%sInvalid Action: %s\n%sUsage: wtodo <action> [options]\n", LIGHT_RED_C, os.Args[1], RESET_C)
-		os.Exit(0)
+		err = invalidInput("Invalid Action: %s\nUsage: wtodo <action> [options]", os.Args[1])
 	}
+
+	// Close the store before exiting, so changes are saved even if the command failed
+	store.Close()
+	checkError(err)
 }
 
 // Generates a username if one is not already made
 // Also ask for postgresql data
-func setup(settings *Settings, dbSetup bool) {
+func setup(settings *Settings, dbSetup bool) error {
 	// If no username, generate one
 	noUser := len(settings.Username) == 0
 	if noUser {
-		rand.Seed(time.Now().UnixNano())
-		v := rand.Int()
-		user, _ := user.Current()
-		settings.Username = fmt.Sprintf("%s-%d", user.Username, v)
+		settings.Username = newUsername()
 		dbSetup = true
 	}
 
+	// If the database was given in the environment, there is nothing to ask
+	if noUser && hasEnvDatabase() {
+		settings.Backend = PostgresBackend
+		dbSetup = false
+	}
+
 	// If no database, setup one
 	// Can also manually show this prompt
 	if dbSetup {
 		// Prompt user asking if they want to use a database
 		// and get the info for the database if yes
-		getDbInfo(settings)
+		err := getDbInfo(settings)
+		if err != nil {
+			return err
+		}
 
 		// If using database, connect and create tables
-		if settings.UseDb {
+		if settings.Backend == PostgresBackend {
 			// Connect to the database
-			db := connectDb(*settings)
+			resolved, err := resolveSettings(*settings)
+			if err != nil {
+				return err
+			}
+			db, err := openDb(resolved)
+			if err != nil {
+				return err
+			}
 			defer db.Close()
 
 			// Create tables if not created
-			createTables(db)
+			err = createTables(db)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	// Save preferences if changed
 	if noUser || dbSetup {
-		savePrefs(settings)
+		return savePrefs(settings)
 	}
+	return nil
+}
+
+// Generates a username from the system username and a random number
+func newUsername() string {
+	rand.Seed(time.Now().UnixNano())
+	v := rand.Int()
+	user, _ := user.Current()
+	return fmt.Sprintf("%s-%d", user.Username, v)
 }
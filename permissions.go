@@ -0,0 +1,68 @@
+package main
+
+import "fmt"
+
+// Roles a member can have in a shared list
+const (
+	OwnerRole  = "owner"
+	EditorRole = "editor"
+	ViewerRole = "viewer"
+)
+
+// Who can change an item: its owner, who it is assigned to,
+// and the role of the current user in the list it is in
+type ItemAccess struct {
+	Owner    string
+	Assignee string
+	List     string
+	Role     string
+}
+
+// Returned when the role of the user does not allow a change
+type PermissionError struct {
+	Action string
+	Id     int
+	List   string
+	Role   string
+}
+
+func (e *PermissionError) Error() string {
+	if e.List == "" {
+		return fmt.Sprintf("Permission denied: only the owner can %s item %d", e.Action, e.Id)
+	}
+	if e.Id == 0 {
+		return fmt.Sprintf("Permission denied: you are a %s of the list %s and can't %s", e.Role, e.List, e.Action)
+	}
+	return fmt.Sprintf("Permission denied: you are a %s of the list %s and can't %s item %d", e.Role, e.List, e.Action, e.Id)
+}
+
+// Checks if a role is one that can be given to a list member
+func validRole(role string) bool {
+	return role == OwnerRole || role == EditorRole || role == ViewerRole
+}
+
+// Checks if a role can add, change and delete the items in a list
+func canEdit(role string) bool {
+	return role == OwnerRole || role == EditorRole
+}
+
+// Checks if a user can do an action (edit, finish or delete) on an item
+// Owners of an item can always change it, and people it is assigned to can edit and finish it
+func (a ItemAccess) allows(user string, action string) bool {
+	if a.Owner == user || canEdit(a.Role) {
+		return true
+	}
+	return a.Assignee == user && action != "delete"
+}
+
+// Helper function to get the error for an action that isn't allowed on an item
+func (a ItemAccess) check(user string, action string, id int) error {
+	if a.allows(user, action) {
+		return nil
+	}
+	role := a.Role
+	if role == "" && a.List != "" {
+		role = "non-member"
+	}
+	return &PermissionError{Action: action, Id: id, List: a.List, Role: role}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Profile that keeps its config and data directly in ~/.wtodo
+const DefaultProfile = "default"
+
+// Function to add, list and switch between profiles, each with their own settings and items
+func profileCommand() error {
+	usageInfo := "Usage: wtodo profile list | add <name> | use <name> | remove [-force] <name>"
+	applyDisplay(DisplaySettings{})
+	if len(os.Args) < 3 {
+		return invalidInput(usageInfo)
+	}
+	if os.Args[2] != "list" && os.Args[2] != "remove" && len(os.Args) != 4 {
+		return invalidInput(usageInfo)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		current := currentProfile()
+		for _, name := range listProfiles() {
+			if name == current {
+				fmt.Printf("%s* %s%s\n", LIGHT_GREEN_C, name, RESET_C)
+			} else {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	case "add":
+		return addProfile(os.Args[3])
+	case "use":
+		name := os.Args[3]
+		err := checkProfile(name)
+		if err != nil {
+			return err
+		}
+		path := getBaseDir() + "/profile"
+		if name == DefaultProfile {
+			err = os.Remove(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(path, []byte(name+"\n"), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not change the profile: %w", err)
+		}
+		fmt.Printf("%sNow using profile %s%s\n", LIGHT_GREEN_C, name, RESET_C)
+	case "remove":
+		var force bool
+		removeFlags := flag.NewFlagSet("remove", flag.ExitOnError)
+		removeFlags.BoolVar(&force, "force", false, "Remove the profile without asking")
+		removeFlags.Parse(os.Args[3:])
+		if removeFlags.NArg() != 1 {
+			return invalidInput(usageInfo)
+		}
+		name := removeFlags.Arg(0)
+		err := checkProfile(name)
+		if err != nil {
+			return err
+		}
+		if name == DefaultProfile {
+			return invalidInput("The default profile can't be removed")
+		}
+		if name == currentProfile() {
+			return &ConflictError{Msg: "Switch to another profile before removing " + name}
+		}
+
+		// The items of the profile are deleted with it, so make sure that is wanted
+		dir := getBaseDir() + "/profiles/" + name
+		if !force {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return invalidInput("Removing profile %s deletes its config and items in %s, use -force to remove it without asking", name, dir)
+			}
+			fmt.Printf("%sRemove profile %s and delete its config and items in %s? [y/N]:%s ", YELLOW_C, name, dir, RESET_C)
+			answer, _ := stdin.ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+				return nil
+			}
+		}
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return fmt.Errorf("Could not remove the profile: %w", err)
+		}
+		fmt.Printf("%sRemoved profile %s%s\n", LIGHT_GREEN_C, name, RESET_C)
+	default:
+		return invalidInput("Invalid profile action: %s\n%s", os.Args[2], usageInfo)
+	}
+	return nil
+}
+
+// Makes a new profile and runs setup for it, keeping the username of the current profile
+func addProfile(name string) error {
+	if !validProfileName(name) || name == DefaultProfile {
+		return invalidInput("Invalid profile name: %s", name)
+	}
+	if profileExists(name) {
+		return &ConflictError{Msg: "Profile already exists: " + name}
+	}
+
+	var current Settings
+	err := loadPrefs(&current)
+	if err != nil {
+		return err
+	}
+
+	// The new profile always keeps its config in its own directory
+	options.Profile, options.Config = name, ""
+	os.Unsetenv("WTODO_CONFIG")
+	settings := Settings{Username: current.Username, Backend: FileBackend}
+	err = setup(&settings, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sAdded profile %s, use it with wtodo --profile %s or wtodo profile use %s%s\n", LIGHT_GREEN_C, name, name, name, RESET_C)
+	return nil
+}
+
+// Gets the names of all profiles, starting with the default one
+func listProfiles() []string {
+	names := []string{}
+	entries, _ := os.ReadDir(getBaseDir() + "/profiles")
+	for _, e := range entries {
+		if e.IsDir() && profileExists(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+// Helper function to check if a profile has been set up
+func profileExists(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+	_, err := os.Stat(getBaseDir() + "/profiles/" + name + "/config.json")
+	return err == nil
+}
+
+// Helper function to check a profile exists
+func checkProfile(name string) error {
+	if !validProfileName(name) || !profileExists(name) {
+		return &NotFoundError{What: "profile", Name: name}
+	}
+	return nil
+}
+
+// Helper function to check a profile name can be used as a directory name
+func validProfileName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Section titles of the report, in the same order as the list command
+var reportSections = []string{"Overdue", "Do Today", "Do Soon", "Do Later (>1 week)"}
+
+// Creates a markdown checklist of all unfinished items, grouped like the list command
+func exportMarkdown(store Store) ([]byte, error) {
+	items, err := store.SelectAll(false)
+	if err != nil {
+		return nil, err
+	}
+	notDone, _ := filterItems(items)
+	sb := strings.Builder{}
+
+	// Write the header
+	currDate := time.Now().Format("Monday January 2, 2006")
+	sb.WriteString(fmt.Sprintf("# %d Items To Do (%s)\n", len(notDone), currDate))
+
+	// Write each section that has items
+	late, today, soon, later := dateSortItems(notDone)
+	for i, section := range [][]Item{late, today, soon, later} {
+		if len(section) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n## %s\n\n", reportSections[i]))
+		for _, t := range section {
+			sb.WriteString(fmt.Sprintf("- [ ] %s (%s)", t.Name, lengthLetter(t.Length)))
+			if t.Priority > 0 {
+				sb.WriteString(" " + strings.Repeat("!", t.Priority))
+			}
+			if !t.Due.IsZero() {
+				sb.WriteString(" - due " + t.Due.Format("Mon 1/2/06 3:04pm"))
+			}
+			for _, tag := range t.Tags {
+				sb.WriteString(" `#" + tag + "`")
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// Creates an org-mode outline of all unfinished items, grouped like the list command
+func exportOrg(store Store) ([]byte, error) {
+	items, err := store.SelectAll(false)
+	if err != nil {
+		return nil, err
+	}
+	notDone, _ := filterItems(items)
+	sb := strings.Builder{}
+
+	// Write the header
+	currDate := time.Now().Format("Monday January 2, 2006")
+	sb.WriteString(fmt.Sprintf("#+TITLE: %d Items To Do (%s)\n", len(notDone), currDate))
+
+	// Write each section that has items
+	late, today, soon, later := dateSortItems(notDone)
+	for i, section := range [][]Item{late, today, soon, later} {
+		if len(section) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n* %s\n", reportSections[i]))
+		for _, t := range section {
+			// Org priorities go from A (high) to C (low)
+			priority := "B"
+			switch t.Priority {
+			case 3:
+				priority = "A"
+			case 1:
+				priority = "C"
+			}
+			sb.WriteString(fmt.Sprintf("** TODO [#%s] %s (%s)", priority, t.Name, lengthLetter(t.Length)))
+
+			// Tags are written at the end of the heading
+			if len(t.Tags) > 0 {
+				tags := make([]string, len(t.Tags))
+				for j, tag := range t.Tags {
+					tags[j] = orgTag(tag)
+				}
+				sb.WriteString(" :" + strings.Join(tags, ":") + ":")
+			}
+			sb.WriteString("\n")
+
+			// Write the due and start dates on the planning line
+			var planning []string
+			if !t.Due.IsZero() {
+				planning = append(planning, "DEADLINE: <"+t.Due.Format("2006-01-02 Mon 15:04")+">")
+			}
+			if !t.Start.IsZero() {
+				planning = append(planning, "SCHEDULED: <"+t.Start.Format("2006-01-02 Mon 15:04")+">")
+			}
+			if len(planning) > 0 {
+				sb.WriteString("   " + strings.Join(planning, " ") + "\n")
+			}
+		}
+	}
+
+	return []byte(sb.String()), nil
+}
+
+// Names of the task lengths
+var lengthNames = []string{"Short", "Medium", "Long"}
+
+// Helper function to get the name of a task length, unknown lengths are short like in lengthLetter
+func lengthName(l TaskLength) string {
+	if l < ShortTask || int(l) >= len(lengthNames) {
+		return lengthNames[ShortTask]
+	}
+	return lengthNames[l]
+}
+
+// Helper function to get the letter shown for a task length
+func lengthLetter(l TaskLength) string {
+	switch l {
+	case LongTask:
+		return "L"
+	case MediumTask:
+		return "M"
+	default:
+		return "S"
+	}
+}
+
+// Helper function to replace the characters org-mode doesn't allow in tags
+func orgTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_@#%", r) {
+			return r
+		}
+		return '_'
+	}, tag)
+}
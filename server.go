@@ -0,0 +1,389 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Web interface served at the root of the server
+//
+//go:embed web/index.html
+var webIndex []byte
+
+// Local HTTP server exposing the items in a store as a JSON API
+type apiServer struct {
+	store Store
+	user  string
+	addr  string
+	mu    sync.Mutex
+}
+
+// Unfinished items split into the same sections as the list command
+type itemBuckets struct {
+	Late  []Item `json:"late"`
+	Today []Item `json:"today"`
+	Soon  []Item `json:"soon"`
+	Later []Item `json:"later"`
+}
+
+// A tag and how many items have it
+type tagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Function to run the HTTP API until killed
+func serve(store Store, username string) error {
+	var addr string
+	serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveFlags.StringVar(&addr, "addr", "127.0.0.1:8080", "Address to listen on")
+	serveFlags.Parse(os.Args[2:])
+
+	srv := &apiServer{store: store, user: username, addr: addr}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items", srv.handleItems)
+	mux.HandleFunc("/items/", srv.handleItem)
+	mux.HandleFunc("/tags", srv.handleTags)
+	mux.HandleFunc("/buckets", srv.handleBuckets)
+	mux.HandleFunc("/", srv.handleIndex)
+
+	fmt.Printf("%sServing wtodo on http://%s%s\n", LIGHT_GREEN_C, addr, RESET_C)
+	err := http.ListenAndServe(addr, srv.wrap(mux))
+	return fmt.Errorf("Could not serve on %s: %w", addr, err)
+}
+
+// Runs one request at a time, since stores are not safe to use concurrently,
+// and turns unexpected panics into error responses
+// Requests for other host names (from DNS rebinding) and changes coming from other websites open in the browser are rejected
+func (srv *apiServer) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, "unknown host "+r.Host)
+			return
+		}
+		origin := r.Header.Get("Origin")
+		if r.Method != http.MethodGet && origin != "" && origin != "http://"+r.Host {
+			writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return
+		}
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println("Error handling", r.Method, r.URL.Path+":", err)
+				writeError(w, http.StatusInternalServerError, fmt.Sprint(err))
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Helper function to check the Host header names this server: the listen address, localhost or an IP address on its port
+// A website can point its own domain at this machine, but its requests still have the domain as the host
+func (srv *apiServer) allowedHost(host string) bool {
+	if host == srv.addr {
+		return true
+	}
+	listenName, listenPort, _ := net.SplitHostPort(srv.addr)
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, "80"
+	}
+	if port != listenPort {
+		return false
+	}
+	return name == "localhost" || name == listenName || net.ParseIP(name) != nil
+}
+
+// GET /items lists items, POST /items creates one
+func (srv *apiServer) handleItems(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// Same filters as the list command
+		query := r.URL.Query()
+		filter := ListFilter{
+			Completed:    query.Get("completed") == "true",
+			Tag:          query.Get("tag"),
+			List:         query.Get("list"),
+			Mine:         query.Get("mine") == "true",
+			AssignedByMe: query.Get("assigned_by_me") == "true",
+			User:         srv.user,
+		}
+		all, err := srv.store.SelectAll(filter.Completed)
+		if writeStoreError(w, err) {
+			return
+		}
+		items := filter.apply(all)
+		if items == nil {
+			items = []Item{}
+		}
+		writeJSON(w, http.StatusOK, items)
+	case http.MethodPost:
+		item := Item{Length: ShortTask, Priority: 2}
+		if !readJSON(w, r, &item) || !srv.validItem(w, item) {
+			return
+		}
+		id, err := srv.store.InsertItem(item)
+		if writeStoreError(w, err) {
+			return
+		}
+		srv.writeItem(w, http.StatusCreated, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Helper function to find the item with the id or whole UUID in a path
+func (srv *apiServer) findItem(key string) (Item, error) {
+	id, err := strconv.Atoi(key)
+	if err == nil {
+		return srv.store.SelectItem(id)
+	}
+	items, err := srv.store.SelectAll(true)
+	if err != nil {
+		return Item{}, err
+	}
+	for _, it := range items {
+		if it.Uuid != "" && strings.EqualFold(it.Uuid, key) {
+			return it, nil
+		}
+	}
+	return Item{}, &NotFoundError{What: "item", Name: key}
+}
+
+// Handles a single item, by id or UUID:
+// GET /items/{id}, PUT or PATCH /items/{id}, DELETE /items/{id},
+// POST /items/{id}/finish, GET or PUT /items/{id}/tags, GET or POST /items/{id}/comments
+func (srv *apiServer) handleItem(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/items/"), "/"), "/")
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	item, err := srv.findItem(parts[0])
+	if writeStoreError(w, err) {
+		return
+	}
+	id := item.Id
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, item)
+	case action == "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		// Fields missing from the body keep their current values
+		if !readJSON(w, r, &item) {
+			return
+		}
+		item.Id = id
+		if !srv.validItem(w, item) {
+			return
+		}
+		if writeStoreError(w, srv.store.UpdateItem(item)) {
+			return
+		}
+		srv.writeItem(w, http.StatusOK, id)
+	case action == "" && r.Method == http.MethodDelete:
+		if writeStoreError(w, srv.store.DeleteItem(id)) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "finish" && r.Method == http.MethodPost:
+		if writeStoreError(w, srv.store.FinishItem(id)) {
+			return
+		}
+		srv.writeItem(w, http.StatusOK, id)
+	case action == "tags" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, append([]string{}, item.Tags...))
+	case action == "tags" && r.Method == http.MethodPut:
+		var tags []string
+		if !readJSON(w, r, &tags) {
+			return
+		}
+		item.Tags = tags
+		if writeStoreError(w, srv.store.UpdateItem(item)) {
+			return
+		}
+		writeJSON(w, http.StatusOK, append([]string{}, tags...))
+	case action == "comments" && r.Method == http.MethodGet:
+		comments, err := srv.store.SelectComments(id)
+		if writeStoreError(w, err) {
+			return
+		}
+		if comments == nil {
+			comments = []Comment{}
+		}
+		writeJSON(w, http.StatusOK, comments)
+	case action == "comments" && r.Method == http.MethodPost:
+		var c Comment
+		if !readJSON(w, r, &c) {
+			return
+		}
+		if strings.TrimSpace(c.Body) == "" {
+			writeError(w, http.StatusBadRequest, "comment body is required")
+			return
+		}
+		c.ItemId = id
+		c.Created = time.Now()
+		if writeStoreError(w, srv.store.AddComment(c)) {
+			return
+		}
+		comments, err := srv.store.SelectComments(id)
+		if writeStoreError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, comments)
+	case action == "" || action == "finish" || action == "tags" || action == "comments":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// GET /buckets lists unfinished items split into overdue, today, soon and later, supports ?tag=<tag> and ?list=<list>
+func (srv *apiServer) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	filter := ListFilter{Tag: r.URL.Query().Get("tag"), List: r.URL.Query().Get("list"), User: srv.user}
+	items, err := srv.store.SelectAll(false)
+	if writeStoreError(w, err) {
+		return
+	}
+	late, today, soon, later := dateSortItems(filter.apply(items))
+	buckets := itemBuckets{[]Item{}, []Item{}, []Item{}, []Item{}}
+	buckets.Late = append(buckets.Late, late...)
+	buckets.Today = append(buckets.Today, today...)
+	buckets.Soon = append(buckets.Soon, soon...)
+	buckets.Later = append(buckets.Later, later...)
+	writeJSON(w, http.StatusOK, buckets)
+}
+
+// GET / serves the web interface
+func (srv *apiServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(webIndex)
+}
+
+// GET /tags lists all tags of unfinished items and how many items have them
+func (srv *apiServer) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	items, err := srv.store.SelectAll(false)
+	if writeStoreError(w, err) {
+		return
+	}
+	counts := make(map[string]int)
+	for _, item := range items {
+		for _, tag := range item.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []tagCount{}
+	for name, count := range counts {
+		tags = append(tags, tagCount{name, count})
+	}
+	sort.Slice(tags, func(p, q int) bool {
+		return tags[p].Name < tags[q].Name
+	})
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// Helper function to check the fields of an item sent to the API, writes an error if invalid
+func (srv *apiServer) validItem(w http.ResponseWriter, item Item) bool {
+	switch {
+	case strings.TrimSpace(item.Name) == "":
+		writeError(w, http.StatusBadRequest, "name is required")
+	case utf8.RuneCountInString(item.Name) > 100:
+		writeError(w, http.StatusBadRequest, "name can be at most 100 characters")
+	case item.Priority < 1 || item.Priority > 3:
+		writeError(w, http.StatusBadRequest, "priority should be 1 (low), 2 (normal) or 3 (high)")
+	case item.Length < ShortTask || item.Length > LongTask:
+		writeError(w, http.StatusBadRequest, "length should be 0 (short), 1 (medium) or 2 (long)")
+	default:
+		return true
+	}
+	return false
+}
+
+// Helper function to write an item from the store as a response
+func (srv *apiServer) writeItem(w http.ResponseWriter, status int, id int) {
+	item, err := srv.store.SelectItem(id)
+	if writeStoreError(w, err) {
+		return
+	}
+	writeJSON(w, status, item)
+}
+
+// HTTP status for each kind of error, matching the exit codes of the commands
+var errorStatus = map[int]int{
+	ExitInvalid:     http.StatusBadRequest,
+	ExitUnavailable: http.StatusServiceUnavailable,
+	ExitNotFound:    http.StatusNotFound,
+	ExitConflict:    http.StatusConflict,
+	ExitPermission:  http.StatusForbidden,
+}
+
+// Helper function to write an error from the store as a response, returns false if there is none
+func writeStoreError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	status, ok := errorStatus[exitCode(err)]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeError(w, status, err.Error())
+	return true
+}
+
+// Helper function to decode a JSON request body, writes an error if invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// Helper function to write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Helper function to write an error as a JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
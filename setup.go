@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Function to set up wtodo from options instead of prompts, for scripts and provisioning:
+// wtodo setup --backend postgres --host ... --user ... --password-stdin --db ...
+// The connection is checked and the tables are made before the settings are saved
+func setupCommand(settings *Settings) error {
+	var backend string
+	var passwordStdin bool
+	db := DatabaseSettings{}
+	setupFlags := flag.NewFlagSet("setup", flag.ExitOnError)
+	setupFlags.StringVar(&backend, "backend", "", "Where to store items: file, postgres, sqlite or git")
+	setupFlags.StringVar(&db.Host, "host", "", "Database host, or the directory of its unix socket")
+	setupFlags.IntVar(&db.Port, "port", 5432, "Database port")
+	setupFlags.StringVar(&db.User, "user", "", "Database user")
+	setupFlags.BoolVar(&passwordStdin, "password-stdin", false, "Read the database password from the first line of stdin")
+	setupFlags.StringVar(&db.PasswordCommand, "password-command", "", "Command that prints the database password")
+	setupFlags.StringVar(&db.Name, "db", "", "Database name")
+	setupFlags.StringVar(&db.SSLMode, "sslmode", "disable", "SSL mode: disable, require, verify-ca or verify-full")
+	setupFlags.StringVar(&db.SSLRootCert, "sslrootcert", "", "Certificate authority to check the server with")
+	setupFlags.StringVar(&db.SSLCert, "sslcert", "", "Client certificate")
+	setupFlags.StringVar(&db.SSLKey, "sslkey", "", "Client certificate key")
+	setupFlags.Parse(os.Args[2:])
+
+	if setupFlags.NArg() > 0 {
+		return invalidInput("Unexpected argument: %s", setupFlags.Arg(0))
+	}
+	if !validSSLMode(db.SSLMode) {
+		return invalidInput("Invalid SSL mode: %s", db.SSLMode)
+	}
+	if passwordStdin {
+		line, _ := stdin.ReadString('\n')
+		db.Password = strings.TrimRight(line, "\r\n")
+		if db.Password == "" {
+			return invalidInput("No password was given on stdin")
+		}
+	}
+
+	switch backend {
+	case PostgresBackend:
+		var missing []string
+		for _, required := range [][2]string{{"--host", db.Host}, {"--user", db.User}, {"--db", db.Name}} {
+			if required[1] == "" {
+				missing = append(missing, required[0])
+			}
+		}
+		if len(missing) > 0 && !hasEnvDatabase() {
+			return invalidInput("Missing %s for the postgres backend", strings.Join(missing, ", "))
+		}
+		settings.Database = db
+	case FileBackend, SqliteBackend, GitBackend:
+		settings.Database = DatabaseSettings{}
+	case "":
+		return invalidInput("Missing --backend")
+	default:
+		return invalidInput("Invalid backend: %s, it should be file, postgres, sqlite or git", backend)
+	}
+	settings.Backend = backend
+	if settings.Username == "" {
+		settings.Username = newUsername()
+	}
+
+	// Check the backend works before saving anything
+	// The environment fills in what the options leave out, but the options given win so the database checked is the one saved
+	if backend == PostgresBackend {
+		resolved, err := resolveSettings(*settings)
+		if err != nil {
+			return err
+		}
+		given := make(map[string]bool)
+		setupFlags.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+		applyOptions(&resolved.Database, db, given)
+		conn, err := openDb(resolved)
+		if err != nil {
+			return err
+		}
+		err = createTables(conn)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		store, err := openStore(*settings)
+		if err != nil {
+			return err
+		}
+		store.Close()
+	}
+
+	err := savePrefs(settings)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sSaved settings to %s%s\n", LIGHT_GREEN_C, getConfigPath(), RESET_C)
+	return nil
+}
+
+// Helper function to put the database options given to setup back over the values from the environment
+func applyOptions(resolved *DatabaseSettings, db DatabaseSettings, given map[string]bool) {
+	for name, field := range map[string][2]*string{
+		"host":             {&resolved.Host, &db.Host},
+		"user":             {&resolved.User, &db.User},
+		"db":               {&resolved.Name, &db.Name},
+		"password-command": {&resolved.PasswordCommand, &db.PasswordCommand},
+		"sslmode":          {&resolved.SSLMode, &db.SSLMode},
+		"sslrootcert":      {&resolved.SSLRootCert, &db.SSLRootCert},
+		"sslcert":          {&resolved.SSLCert, &db.SSLCert},
+		"sslkey":           {&resolved.SSLKey, &db.SSLKey},
+	} {
+		if given[name] {
+			*field[0] = *field[1]
+		}
+	}
+	if given["port"] {
+		resolved.Port = db.Port
+	}
+
+	// A password from stdin or a command is used instead of PGPASSWORD
+	if given["password-stdin"] || given["password-command"] {
+		resolved.Password = db.Password
+	}
+}
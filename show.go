@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Function to show all details of an item and its comments
+func showItem(store Store) error {
+	if len(os.Args) != 3 {
+		return invalidInput("Usage: wtodo show <id or name>")
+	}
+	t, err := findItemArg(store, os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	// Show the item with the id commands take, its short id if they are turned on
+	var ids map[int]string
+	if shortIds {
+		all, err := store.SelectAll(true)
+		if err != nil {
+			return err
+		}
+		ids = shortIdMap(all)
+	}
+	id := displayId(t, ids)
+
+	// Print the name and all other fields that are set
+	status := "To do"
+	if t.Finished {
+		status = "Completed"
+	}
+	fmt.Printf("%s%s. %s%s%s (%s)%s\n", DARK_GREY_C, id, RESET_C, WHITE_C, t.Name, status, RESET_C)
+	printField("Due", formatShowDate(t.Due))
+	printField("Start", formatShowDate(t.Start))
+	printField("Length", lengthName(t.Length))
+	printField("Priority", fmt.Sprintf("%s (%d)", strings.Repeat("!", t.Priority), t.Priority))
+	printField("Tags", strings.Join(t.Tags, ", "))
+	printField("List", t.List)
+	printField("Assigned to", t.Assignee)
+	printField("Added by", t.Owner)
+	printField("UUID", t.Uuid)
+
+	// Print the comment thread
+	comments, err := store.SelectComments(t.Id)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		fmt.Printf("\n%sNo comments, use %swtodo comment %s \"text\"%s to add one%s\n", GREY_C, WHITE_C, id, GREY_C, RESET_C)
+		return nil
+	}
+	fmt.Printf("\n%sCOMMENTS (%d)%s\n", GREY_C, len(comments), RESET_C)
+	for _, c := range comments {
+		fmt.Printf("%s%s%s %s%s%s\n", TITLE1_C, c.Author, RESET_C, DARK_GREY_C, c.Created.Format("Mon 1/2/06 3:04pm"), RESET_C)
+		for _, line := range strings.Split(c.Body, "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// Function to add a comment to an item
+func commentItem(store Store) error {
+	if len(os.Args) < 4 {
+		return invalidInput("Usage: wtodo comment <id or name> <text>")
+	}
+	t, err := findItemArg(store, os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	body := strings.TrimSpace(strings.Join(os.Args[3:], " "))
+	if body == "" {
+		return invalidInput("Comment can't be empty!")
+	}
+	return store.AddComment(Comment{ItemId: t.Id, Created: time.Now(), Body: body})
+}
+
+// Helper function to print one field of an item if it is set
+func printField(name string, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Printf("  %s%-12s%s %s\n", GREY_C, name+":", RESET_C, value)
+}
+
+// Helper function to format a date for show, empty if zero time
+func formatShowDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("Monday January 2, 2006 3:04pm")
+}
@@ -0,0 +1,290 @@
+package main
+
+// Backend that todo items are stored in
+// Items that don't exist (or the user can't see) give a *NotFoundError, changes to items give a *PermissionError
+// if the user's role in a shared list doesn't allow them, and an *UnavailableError is returned if the backend stops working
+type Store interface {
+	SelectAll(finished bool) ([]Item, error)
+	SelectItem(id int) (Item, error)
+	InsertItem(item Item) (int, error)
+	UpdateItem(item Item) error
+	FinishItem(id int) error
+	DeleteItem(id int) error
+	SelectExternalId(source string, externalId string) (int, error)
+	SelectExternalIds(source string) (map[int]string, error)
+	InsertExternalId(source string, externalId string, id int) error
+	RenameUser(newName string) error
+	ClaimItems() (int, error)
+	SelectLists() ([]TodoList, error)
+	CreateList(name string) error
+	JoinList(name string) error
+	LeaveList(name string) error
+	SetListRole(name string, username string, role string) error
+	RemoveListMember(name string, username string) error
+	SelectComments(id int) ([]Comment, error)
+	AddComment(c Comment) error
+	RestoreComment(c Comment) error
+	Watch(onChange func(Change)) error
+	Close()
+}
+
+// Backends that items can be stored in
+const (
+	FileBackend     = "file"
+	PostgresBackend = "postgres"
+	GitBackend      = "git"
+	SqliteBackend   = "sqlite"
+)
+
+// Opens the store chosen in the settings
+func openStore(settings Settings) (Store, error) {
+	switch settings.Backend {
+	case PostgresBackend:
+		return openCachedStore(settings)
+	case GitBackend:
+		return openGitStore(getDataDir()+"/repo", settings.Username)
+	case SqliteBackend:
+		return openSqliteStore(getDataDir()+"/items.db", settings.Username)
+	default:
+		return openFileStore(getDataDir()+"/items.json", settings.Username)
+	}
+}
+
+// Opens the sqlite database at the given path, creating the tables if they don't exist
+func openSqliteStore(path string, username string) (*dbStore, error) {
+	db, err := openSqlite(path)
+	if err != nil {
+		return nil, err
+	}
+	err = createTables(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &dbStore{db: db, owner: username}, nil
+}
+
+// Store backed by the postgresql or sqlite database, only showing the items of one user
+type dbStore struct {
+	db      *Database
+	owner   string
+	connStr string
+}
+
+func (s *dbStore) SelectAll(finished bool) ([]Item, error) {
+	return selectAll(s.db, s.owner, finished)
+}
+
+func (s *dbStore) SelectItem(id int) (Item, error) {
+	return selectItem(s.db, s.owner, id)
+}
+
+func (s *dbStore) InsertItem(item Item) (int, error) {
+	err := s.checkList(item.List, "add items to it")
+	if err != nil {
+		return 0, err
+	}
+	return insertItem(s.db, s.owner, item)
+}
+
+func (s *dbStore) UpdateItem(item Item) error {
+	err := s.checkItem(item.Id, "edit")
+	if err != nil {
+		return err
+	}
+
+	// Moving an item to another list needs permission in that list too
+	if item.List != "" {
+		current, err := selectItem(s.db, s.owner, item.Id)
+		if err != nil {
+			return err
+		}
+		if item.List != current.List {
+			err = s.checkList(item.List, "move items to it")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return updateItem(s.db, s.owner, item)
+}
+
+func (s *dbStore) FinishItem(id int) error {
+	err := s.checkItem(id, "finish")
+	if err != nil {
+		return err
+	}
+	return updateFinishItem(s.db, s.owner, id)
+}
+
+func (s *dbStore) DeleteItem(id int) error {
+	err := s.checkItem(id, "delete")
+	if err != nil {
+		return err
+	}
+	return deleteItemDb(s.db, s.owner, id)
+}
+
+// Helper function to check if the user can do an action on an item
+func (s *dbStore) checkItem(id int, action string) error {
+	access, ok, err := selectItemAccess(s.db, s.owner, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &NotFoundError{What: "item", Id: id}
+	}
+	return access.check(s.owner, action, id)
+}
+
+// Helper function to check if the user can change the items of a list
+func (s *dbStore) checkList(name string, action string) error {
+	if name == "" {
+		return nil
+	}
+	role, err := selectListRole(s.db, s.owner, name)
+	if err != nil || canEdit(role) {
+		return err
+	}
+	if role == "" {
+		role = "non-member"
+	}
+	return &PermissionError{Action: action, List: name, Role: role}
+}
+
+func (s *dbStore) SelectExternalId(source string, externalId string) (int, error) {
+	return selectExternalId(s.db, s.owner, source, externalId)
+}
+
+func (s *dbStore) SelectExternalIds(source string) (map[int]string, error) {
+	return selectExternalIds(s.db, s.owner, source)
+}
+
+func (s *dbStore) InsertExternalId(source string, externalId string, id int) error {
+	return insertExternalId(s.db, s.owner, source, externalId, id)
+}
+
+// Moves all items, lists and comments to the new username, a *ConflictError if the name is already used
+func (s *dbStore) RenameUser(newName string) error {
+	exists, err := ownerExists(s.db, newName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &ConflictError{Msg: "The username " + newName + " is already used"}
+	}
+	err = renameOwner(s.db, s.owner, newName)
+	if err != nil {
+		return err
+	}
+	s.owner = newName
+	return nil
+}
+
+// Gives the items made before items had owners to the user, returning how many there were
+func (s *dbStore) ClaimItems() (int, error) {
+	return claimItems(s.db, s.owner)
+}
+
+// Counts the items nobody has claimed yet
+func (s *dbStore) unowned() (int, error) {
+	return countUnowned(s.db)
+}
+
+func (s *dbStore) SelectLists() ([]TodoList, error) {
+	return selectLists(s.db, s.owner)
+}
+
+func (s *dbStore) CreateList(name string) error {
+	ok, err := insertList(s.db, s.owner, name)
+	if err == nil && !ok {
+		err = &ConflictError{Msg: "A list named " + name + " already exists"}
+	}
+	return err
+}
+
+// Users joining a list on their own can only view it until an owner changes their role
+func (s *dbStore) JoinList(name string) error {
+	ok, err := insertListMember(s.db, s.owner, name, ViewerRole)
+	if err == nil && !ok {
+		err = &NotFoundError{What: "list", Name: name}
+	}
+	return err
+}
+
+func (s *dbStore) LeaveList(name string) error {
+	ok, err := deleteListMember(s.db, s.owner, name)
+	if err == nil && !ok {
+		err = &NotFoundError{What: "list you are in", Name: name}
+	}
+	return err
+}
+
+// Adds a user to a list or changes their role, only owners of the list can do this
+func (s *dbStore) SetListRole(name string, username string, role string) error {
+	err := s.checkOwner(name, "change roles")
+	if err != nil {
+		return err
+	}
+	ok, err := updateListRole(s.db, username, name, role)
+	if err == nil && !ok {
+		_, err = insertListMember(s.db, username, name, role)
+	}
+	return err
+}
+
+// Removes a user from a list, only owners of the list can do this
+func (s *dbStore) RemoveListMember(name string, username string) error {
+	err := s.checkOwner(name, "remove members")
+	if err != nil {
+		return err
+	}
+	_, err = deleteListMember(s.db, username, name)
+	return err
+}
+
+// Helper function to check if the user is an owner of a list
+func (s *dbStore) checkOwner(name string, action string) error {
+	role, err := selectListRole(s.db, s.owner, name)
+	if err != nil || role == OwnerRole {
+		return err
+	}
+	if role == "" {
+		role = "non-member"
+	}
+	return &PermissionError{Action: action, List: name, Role: role}
+}
+
+func (s *dbStore) SelectComments(id int) ([]Comment, error) {
+	_, err := selectItem(s.db, s.owner, id)
+	if err != nil {
+		return nil, err
+	}
+	return selectComments(s.db, id)
+}
+
+// Anyone that can see an item can comment on it, the comment is always by the current user
+func (s *dbStore) AddComment(c Comment) error {
+	_, err := selectItem(s.db, s.owner, c.ItemId)
+	if err != nil {
+		return err
+	}
+	c.Author = s.owner
+	return insertComment(s.db, c)
+}
+
+// Adds a comment from a backup, keeping who wrote it and when
+func (s *dbStore) RestoreComment(c Comment) error {
+	_, err := selectItem(s.db, s.owner, c.ItemId)
+	if err != nil {
+		return err
+	}
+	if c.Author == "" {
+		c.Author = s.owner
+	}
+	return insertComment(s.db, c)
+}
+
+func (s *dbStore) Close() {
+	s.db.Close()
+}
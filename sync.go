@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How long deletions are remembered, a copy of a deleted item that shows up after this is added back
+const tombstoneAge = 90 * 24 * time.Hour
+
+// What both stores looked like after the last sync, used to find which side changed an item
+// Items are keyed by their UUID, which is the same in every store they are in
+type SyncState struct {
+	LastSync   time.Time            `json:"last_sync"`
+	Items      map[string]Item      `json:"items"`
+	Tombstones map[string]time.Time `json:"tombstones"`
+}
+
+// What a sync changed on each side
+type SyncSummary struct {
+	Pushed    []string
+	Pulled    []string
+	Conflicts []string
+}
+
+// A field of an item that is merged on its own
+type syncField struct {
+	Name  string
+	Equal func(a Item, b Item) bool
+	Copy  func(dst *Item, src Item)
+}
+
+// Fields merged by sync, an item changed on both sides keeps the changes to different fields from both
+var syncFields = []syncField{
+	{"name", func(a, b Item) bool { return a.Name == b.Name }, func(d *Item, s Item) { d.Name = s.Name }},
+	{"due", func(a, b Item) bool { return a.Due.Equal(b.Due) }, func(d *Item, s Item) { d.Due = s.Due }},
+	{"start", func(a, b Item) bool { return a.Start.Equal(b.Start) }, func(d *Item, s Item) { d.Start = s.Start }},
+	{"length", func(a, b Item) bool { return a.Length == b.Length }, func(d *Item, s Item) { d.Length = s.Length }},
+	{"priority", func(a, b Item) bool { return a.Priority == b.Priority }, func(d *Item, s Item) { d.Priority = s.Priority }},
+	{"finished", func(a, b Item) bool { return a.Finished == b.Finished }, func(d *Item, s Item) { d.Finished = s.Finished }},
+	{"tags", func(a, b Item) bool { return tagKey(a) == tagKey(b) }, func(d *Item, s Item) { d.Tags = s.Tags }},
+	{"list", func(a, b Item) bool { return a.List == b.List }, func(d *Item, s Item) { d.List = s.List }},
+	{"assignee", func(a, b Item) bool { return a.Assignee == b.Assignee }, func(d *Item, s Item) { d.Assignee = s.Assignee }},
+}
+
+// Function to sync the local data file with the postgresql database
+func syncCommand(store Store, settings Settings) error {
+	if settings.Backend != PostgresBackend {
+		return invalidInput("Sync needs a postgresql database, run wtodo setup to add one")
+	}
+	if _, offline := store.(*offlineStore); offline {
+		return &UnavailableError{Err: errors.New("can't sync while the database can't be reached")}
+	}
+
+	local, err := openFileStore(getDataDir()+"/items.json", settings.Username)
+	if err != nil {
+		return err
+	}
+	statePath := getDataDir() + "/sync-" + storeKey(settings) + ".json"
+	state, err := loadSyncState(statePath)
+	if err != nil {
+		return err
+	}
+	summary, err := syncStores(local, store, &state)
+	if err != nil {
+		return err
+	}
+	state.LastSync = time.Now()
+	err = saveSyncState(statePath, state)
+	if err != nil {
+		return err
+	}
+
+	// Print what happened
+	fmt.Printf("%sPushed %d and pulled %d changes, %d conflicts%s\n", LIGHT_GREEN_C, len(summary.Pushed), len(summary.Pulled), len(summary.Conflicts), RESET_C)
+	for _, s := range summary.Pushed {
+		fmt.Printf("  %spushed%s %s\n", GREY_C, RESET_C, s)
+	}
+	for _, s := range summary.Pulled {
+		fmt.Printf("  %spulled%s %s\n", GREY_C, RESET_C, s)
+	}
+	for _, s := range summary.Conflicts {
+		fmt.Printf("  %sconflict%s %s\n", RED_C, RESET_C, s)
+	}
+	return nil
+}
+
+// Makes the items in both stores the same, using the state to tell which side changed
+// Fields changed on both sides take the value from the side updated last
+func syncStores(local Store, remote Store, state *SyncState) (SyncSummary, error) {
+	var summary SyncSummary
+	if state.Items == nil {
+		state.Items = make(map[string]Item)
+	}
+	if state.Tombstones == nil {
+		state.Tombstones = make(map[string]time.Time)
+	}
+	for uuid, deleted := range state.Tombstones {
+		if time.Since(deleted) > tombstoneAge {
+			delete(state.Tombstones, uuid)
+		}
+	}
+
+	localItems, err := syncItems(local)
+	if err != nil {
+		return summary, err
+	}
+	remoteItems, err := syncItems(remote)
+	if err != nil {
+		return summary, err
+	}
+
+	// Go through every item known to either side, in a stable order
+	uuids := make(map[string]bool)
+	for _, m := range []map[string]Item{localItems, remoteItems, state.Items} {
+		for uuid := range m {
+			uuids[uuid] = true
+		}
+	}
+	var order []string
+	for uuid := range uuids {
+		order = append(order, uuid)
+	}
+	sort.Strings(order)
+
+	for _, uuid := range order {
+		l, inLocal := localItems[uuid]
+		r, inRemote := remoteItems[uuid]
+		base, inBase := state.Items[uuid]
+		tombstone, deleted := state.Tombstones[uuid]
+
+		switch {
+		case inLocal && inRemote:
+			merged, conflicts := mergeItems(l, r, base, inBase)
+			for _, c := range conflicts {
+				summary.Conflicts = append(summary.Conflicts, fmt.Sprintf("%s: %s", describeSync(merged), c))
+			}
+			if !itemsMatch(l, merged) {
+				merged.Id = l.Id
+				if syncWrite(&summary, local.UpdateItem(merged), merged) {
+					summary.Pulled = append(summary.Pulled, "update "+describeSync(merged))
+				}
+			}
+			if !itemsMatch(r, merged) {
+				merged.Id = r.Id
+				if syncWrite(&summary, remote.UpdateItem(merged), merged) {
+					summary.Pushed = append(summary.Pushed, "update "+describeSync(merged))
+				}
+			}
+			state.Items[uuid] = merged
+
+		case inLocal || inRemote:
+			// The item is only on one side, so it is either new or was deleted on the other side
+			from, to, it := local, remote, l
+			added, removed := &summary.Pushed, &summary.Pulled
+			if inRemote {
+				from, to, it = remote, local, r
+				added, removed = &summary.Pulled, &summary.Pushed
+			}
+
+			// Only copies that missed the deletion are deleted, an item added again since (eg. by restore) is new
+			if deleted && it.Updated.After(tombstone) {
+				deleted = false
+				delete(state.Tombstones, uuid)
+			}
+
+			if inBase || deleted {
+				if inBase && !itemsMatch(it, base) {
+					// Changed on one side and deleted on the other, keep the changes
+					summary.Conflicts = append(summary.Conflicts, describeSync(it)+": deleted on one side and changed on the other, keeping it")
+				} else {
+					if syncWrite(&summary, from.DeleteItem(it.Id), it) {
+						*removed = append(*removed, "delete "+describeSync(it))
+						delete(state.Items, uuid)
+						state.Tombstones[uuid] = time.Now()
+					}
+					continue
+				}
+			}
+
+			_, err := to.InsertItem(it)
+			if syncWrite(&summary, err, it) {
+				*added = append(*added, "add "+describeSync(it))
+				state.Items[uuid] = it
+				delete(state.Tombstones, uuid)
+			}
+
+		default:
+			// Deleted on both sides
+			delete(state.Items, uuid)
+			state.Tombstones[uuid] = time.Now()
+		}
+	}
+
+	return summary, nil
+}
+
+// Merges the fields of an item from both sides, returning the fields that conflicted
+func mergeItems(l Item, r Item, base Item, inBase bool) (Item, []string) {
+	merged := l
+	var conflicts []string
+	for _, f := range syncFields {
+		if f.Equal(l, r) {
+			continue
+		}
+		localChanged := !inBase || !f.Equal(l, base)
+		remoteChanged := !inBase || !f.Equal(r, base)
+		switch {
+		case localChanged && remoteChanged:
+			// Last writer wins
+			winner, side := l, "local"
+			if r.Updated.After(l.Updated) {
+				winner, side = r, "database"
+			}
+			f.Copy(&merged, winner)
+			conflicts = append(conflicts, fmt.Sprintf("%s changed on both sides, kept the %s value", f.Name, side))
+		case remoteChanged:
+			f.Copy(&merged, r)
+		}
+	}
+	return merged, conflicts
+}
+
+// Loads all items of a store keyed by their UUID
+func syncItems(store Store) (map[string]Item, error) {
+	all, err := store.SelectAll(true)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]Item)
+	for _, it := range all {
+		items[it.Uuid] = it
+	}
+	return items, nil
+}
+
+// Helper function to record a failed write as a conflict, returns true if it succeeded
+func syncWrite(summary *SyncSummary, err error, it Item) bool {
+	if err == nil {
+		return true
+	}
+	summary.Conflicts = append(summary.Conflicts, fmt.Sprintf("%s: %s", describeSync(it), err))
+	return false
+}
+
+// Helper function to check if all synced fields of two items are the same
+func itemsMatch(a Item, b Item) bool {
+	for _, f := range syncFields {
+		if !f.Equal(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function to compare tags without caring about their order
+func tagKey(t Item) string {
+	tags := append([]string{}, t.Tags...)
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// Helper function to describe an item in the sync summary
+func describeSync(t Item) string {
+	return fmt.Sprintf("\"%s\"", t.Name)
+}
+
+// Loads the state of the last sync, empty if there never was one
+func loadSyncState(path string) (SyncState, error) {
+	var state SyncState
+	content, err := readDataFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, fmt.Errorf("Could not open sync state: %w", err)
+	}
+	state = SyncState{}
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return state, fmt.Errorf("Sync state is corrupted: %w", err)
+	}
+	return state, nil
+}
+
+// Saves the state of the sync for next time
+func saveSyncState(path string, state SyncState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = writeDataFile(path, content)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not save sync state: %w", err)
+	}
+	return nil
+}
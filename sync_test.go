@@ -0,0 +1,278 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeItems(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	base := Item{Name: "Buy milk", Priority: 1, Tags: []string{"home"}}
+
+	tests := []struct {
+		name      string
+		local     Item
+		remote    Item
+		base      Item
+		inBase    bool
+		want      Item
+		conflicts int
+	}{
+		{
+			name:   "unchanged",
+			local:  base,
+			remote: base,
+			base:   base,
+			inBase: true,
+			want:   base,
+		},
+		{
+			name:   "changed on one side",
+			local:  base,
+			remote: Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}},
+			base:   base,
+			inBase: true,
+			want:   Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}},
+		},
+		{
+			name:   "different fields changed on each side",
+			local:  Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}},
+			remote: Item{Name: "Buy milk", Priority: 3, Tags: []string{"home"}},
+			base:   base,
+			inBase: true,
+			want:   Item{Name: "Buy oat milk", Priority: 3, Tags: []string{"home"}},
+		},
+		{
+			name:      "same field changed on both sides, remote updated last",
+			local:     Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}, Updated: earlier},
+			remote:    Item{Name: "Buy soy milk", Priority: 1, Tags: []string{"home"}, Updated: later},
+			base:      base,
+			inBase:    true,
+			want:      Item{Name: "Buy soy milk", Priority: 1, Tags: []string{"home"}, Updated: earlier},
+			conflicts: 1,
+		},
+		{
+			name:      "same field changed on both sides, local updated last",
+			local:     Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}, Updated: later},
+			remote:    Item{Name: "Buy soy milk", Priority: 1, Tags: []string{"home"}, Updated: earlier},
+			base:      base,
+			inBase:    true,
+			want:      Item{Name: "Buy oat milk", Priority: 1, Tags: []string{"home"}, Updated: later},
+			conflicts: 1,
+		},
+		{
+			name:   "tags in another order",
+			local:  Item{Name: "Buy milk", Tags: []string{"a", "b"}},
+			remote: Item{Name: "Buy milk", Tags: []string{"b", "a"}},
+			want:   Item{Name: "Buy milk", Tags: []string{"a", "b"}},
+		},
+		{
+			name:      "never synced and different",
+			local:     Item{Name: "Buy milk", Priority: 1, Updated: earlier},
+			remote:    Item{Name: "Buy milk", Priority: 2, Updated: later},
+			want:      Item{Name: "Buy milk", Priority: 2, Updated: earlier},
+			conflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := mergeItems(tt.local, tt.remote, tt.base, tt.inBase)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged %+v, want %+v", got, tt.want)
+			}
+			if len(conflicts) != tt.conflicts {
+				t.Errorf("got conflicts %q, want %d", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+// Helper function to make an empty data file store in a temporary directory
+func testFileStore(t *testing.T, name string) *fileStore {
+	s, err := openFileStore(filepath.Join(t.TempDir(), name+".json"), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Helper function to get the names of all items in a store by UUID
+func itemNames(t *testing.T, s Store) map[string]string {
+	items, err := s.SelectAll(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string)
+	for _, it := range items {
+		names[it.Uuid] = it.Name
+	}
+	return names
+}
+
+// Helper function to sync two stores, failing the test if it returns an error
+func testSync(t *testing.T, local Store, remote Store, state *SyncState) SyncSummary {
+	summary, err := syncStores(local, remote, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary
+}
+
+func TestSyncStores(t *testing.T) {
+	tests := []struct {
+		name      string
+		run       func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary
+		local     []string
+		remote    []string
+		conflicts int
+	}{
+		{
+			name: "new items are copied both ways",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				local.InsertItem(Item{Name: "local"})
+				remote.InsertItem(Item{Name: "remote"})
+				return testSync(t, local, remote, state)
+			},
+			local:  []string{"local", "remote"},
+			remote: []string{"local", "remote"},
+		},
+		{
+			name: "the same item on both sides is matched by uuid",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				uuid, err := newUUID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				local.InsertItem(Item{Uuid: uuid, Name: "restored"})
+				remote.InsertItem(Item{Uuid: uuid, Name: "restored"})
+				testSync(t, local, remote, state)
+				return testSync(t, local, remote, state)
+			},
+			local:  []string{"restored"},
+			remote: []string{"restored"},
+		},
+		{
+			name: "deleted items are deleted on the other side and not added back",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				id, _ := local.InsertItem(Item{Name: "done"})
+				local.InsertItem(Item{Name: "kept"})
+				testSync(t, local, remote, state)
+				local.DeleteItem(id)
+				testSync(t, local, remote, state)
+				return testSync(t, local, remote, state)
+			},
+			local:  []string{"kept"},
+			remote: []string{"kept"},
+		},
+		{
+			name: "an item added again after it was deleted is synced",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				id, _ := local.InsertItem(Item{Name: "restored"})
+				testSync(t, local, remote, state)
+				it, _ := local.SelectItem(id)
+				local.DeleteItem(id)
+				testSync(t, local, remote, state)
+				local.InsertItem(Item{Uuid: it.Uuid, Name: "restored"})
+				summary := testSync(t, local, remote, state)
+				if _, ok := state.Tombstones[it.Uuid]; ok {
+					t.Errorf("tombstone of %s was kept", it.Uuid)
+				}
+				return summary
+			},
+			local:  []string{"restored"},
+			remote: []string{"restored"},
+		},
+		{
+			name: "a copy that missed the deletion is deleted and old tombstones expire",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				local.InsertItem(Item{Name: "stale"})
+				items, _ := local.SelectAll(true)
+				state.Tombstones = map[string]time.Time{items[0].Uuid: time.Now(), "old": time.Now().Add(-2 * tombstoneAge)}
+				summary := testSync(t, local, remote, state)
+				if _, ok := state.Tombstones["old"]; ok {
+					t.Errorf("old tombstone didn't expire")
+				}
+				return summary
+			},
+		},
+		{
+			name: "deleted on one side and changed on the other keeps the change",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				id, _ := local.InsertItem(Item{Name: "item"})
+				testSync(t, local, remote, state)
+				local.DeleteItem(id)
+				items, _ := remote.SelectAll(true)
+				items[0].Name = "changed"
+				remote.UpdateItem(items[0])
+				return testSync(t, local, remote, state)
+			},
+			local:     []string{"changed"},
+			remote:    []string{"changed"},
+			conflicts: 1,
+		},
+		{
+			name: "changes to different fields are merged",
+			run: func(t *testing.T, local *fileStore, remote *fileStore, state *SyncState) SyncSummary {
+				id, _ := local.InsertItem(Item{Name: "item", Priority: 1})
+				testSync(t, local, remote, state)
+				it, _ := local.SelectItem(id)
+				it.Name = "renamed"
+				local.UpdateItem(it)
+				items, _ := remote.SelectAll(true)
+				items[0].Priority = 3
+				remote.UpdateItem(items[0])
+				summary := testSync(t, local, remote, state)
+				items, _ = local.SelectAll(true)
+				if items[0].Priority != 3 {
+					t.Errorf("local priority is %d, want 3", items[0].Priority)
+				}
+				return summary
+			},
+			local:  []string{"renamed"},
+			remote: []string{"renamed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := testFileStore(t, "local"), testFileStore(t, "remote")
+			state := &SyncState{}
+			summary := tt.run(t, local, remote, state)
+			if len(summary.Conflicts) != tt.conflicts {
+				t.Errorf("got conflicts %q, want %d", summary.Conflicts, tt.conflicts)
+			}
+
+			for side, want := range map[Store][]string{local: tt.local, remote: tt.remote} {
+				var got []string
+				for _, name := range itemNames(t, side) {
+					got = append(got, name)
+				}
+				if !sameNames(got, want) {
+					t.Errorf("got items %q, want %q", got, want)
+				}
+			}
+			if !reflect.DeepEqual(itemNames(t, local), itemNames(t, remote)) {
+				t.Errorf("stores differ: %v and %v", itemNames(t, local), itemNames(t, remote))
+			}
+		})
+	}
+}
+
+// Helper function to compare lists of names without caring about their order
+func sameNames(a []string, b []string) bool {
+	counts := make(map[string]int)
+	for _, name := range a {
+		counts[name]++
+	}
+	for _, name := range b {
+		counts[name]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
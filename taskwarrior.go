@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Source name used to map Taskwarrior UUIDs to items
+const TaskwarriorSource = "taskwarrior"
+
+// Date format used by Taskwarrior in its JSON (always UTC)
+const taskwarriorDate = "20060102T150405Z"
+
+// One task from the output of "task export"
+type TaskwarriorTask struct {
+	Uuid        string   `json:"uuid"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Entry       string   `json:"entry,omitempty"`
+	End         string   `json:"end,omitempty"`
+	Due         string   `json:"due,omitempty"`
+	Scheduled   string   `json:"scheduled,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Imports the tasks from a Taskwarrior export, updating items that were imported before
+// Returns the number of items added and updated
+func importTaskwarrior(store Store, data []byte) (added int, updated int, err error) {
+	tasks, err := parseTaskwarrior(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Items keep their UUID wherever they go, so a task can also be an item that was restored or synced here
+	all, err := store.SelectAll(true)
+	if err != nil {
+		return 0, 0, err
+	}
+	uuids := make(map[string]int)
+	for _, it := range all {
+		uuids[strings.ToLower(it.Uuid)] = it.Id
+	}
+
+	for _, task := range tasks {
+		// Recurring templates are not real tasks, only their instances are
+		if task.Status == "recurring" {
+			continue
+		}
+
+		// Find the item this task was imported to before, it might have been deleted since
+		id := 0
+		item := Item{Length: ShortTask}
+		if task.Uuid != "" {
+			id, err = store.SelectExternalId(TaskwarriorSource, task.Uuid)
+			if err != nil {
+				return added, updated, err
+			}
+			if id == 0 {
+				id = uuids[strings.ToLower(task.Uuid)]
+			}
+		}
+		if id != 0 {
+			item, err = store.SelectItem(id)
+			var notFound *NotFoundError
+			if errors.As(err, &notFound) {
+				id, item = 0, Item{Length: ShortTask}
+			} else if err != nil {
+				return added, updated, err
+			}
+		}
+
+		// Deleted tasks remove the item if we have it
+		if task.Status == "deleted" {
+			if id != 0 {
+				err = store.DeleteItem(id)
+				if err != nil {
+					return added, updated, err
+				}
+			}
+			continue
+		}
+
+		// Convert to an item, keeping the fields Taskwarrior doesn't know about
+		err = taskwarriorToItem(task, &item)
+		if err != nil {
+			return added, updated, err
+		}
+
+		// Update or insert the item
+		if id != 0 {
+			err = store.UpdateItem(item)
+			updated++
+		} else {
+			// New items keep the task's UUID and entry date, so the same item has one UUID everywhere
+			item.Uuid = task.Uuid
+			item.Created, err = parseTaskwarriorDate(task.Entry)
+			if err != nil {
+				return added, updated, err
+			}
+			id, err = store.InsertItem(item)
+			added++
+		}
+		if err != nil {
+			return added, updated, err
+		}
+
+		// Save the mapping so the next import finds the same item
+		if task.Uuid != "" {
+			err = store.InsertExternalId(TaskwarriorSource, task.Uuid, id)
+			if err != nil {
+				return added, updated, err
+			}
+		}
+	}
+
+	return added, updated, nil
+}
+
+// Exports all items, including finished ones, as Taskwarrior JSON
+func exportTaskwarrior(store Store) ([]byte, error) {
+	items, err := store.SelectAll(true)
+	if err != nil {
+		return nil, err
+	}
+	uuids, err := store.SelectExternalIds(TaskwarriorSource)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []TaskwarriorTask{}
+	for _, item := range items {
+		// Items that never came from Taskwarrior are exported with their own UUID, which import matches too
+		task := itemToTaskwarrior(item)
+		task.Uuid = item.Uuid
+		if uuid, ok := uuids[item.Id]; ok {
+			task.Uuid = uuid
+		}
+		tasks = append(tasks, task)
+	}
+
+	out, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Taskwarrior JSON: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// Parses the output of "task export", which is either a JSON array
+// or one JSON object per line for older versions of Taskwarrior
+func parseTaskwarrior(data []byte) ([]TaskwarriorTask, error) {
+	var tasks []TaskwarriorTask
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return tasks, nil
+	}
+
+	if data[0] == '[' {
+		err := json.Unmarshal(data, &tasks)
+		if err != nil {
+			return nil, invalidInput("Invalid Taskwarrior JSON: %s", err)
+		}
+		return tasks, nil
+	}
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(bytes.TrimSpace(line), ",")
+		if len(line) == 0 {
+			continue
+		}
+		var task TaskwarriorTask
+		err := json.Unmarshal(line, &task)
+		if err != nil {
+			return nil, invalidInput("Invalid Taskwarrior JSON on line %d: %s", i+1, err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// Copies the fields of a Taskwarrior task into an item
+func taskwarriorToItem(task TaskwarriorTask, item *Item) error {
+	// Names are cut to 100 letters, not bytes, so letters that take several bytes aren't split
+	item.Name = task.Description
+	if name := []rune(item.Name); len(name) > 100 {
+		item.Name = string(name[:100])
+	}
+	var err error
+	item.Due, err = parseTaskwarriorDate(task.Due)
+	if err != nil {
+		return err
+	}
+	item.Start, err = parseTaskwarriorDate(task.Scheduled)
+	if err != nil {
+		return err
+	}
+	item.Finished = task.Status == "completed"
+	item.Tags = task.Tags
+
+	switch task.Priority {
+	case "H":
+		item.Priority = 3
+	case "L":
+		item.Priority = 1
+	default:
+		item.Priority = 2
+	}
+	return nil
+}
+
+// Converts an item into a Taskwarrior task, without the uuid
+// Items don't keep when they were finished, so finished items end at their last update
+func itemToTaskwarrior(item Item) TaskwarriorTask {
+	task := TaskwarriorTask{
+		Description: item.Name,
+		Status:      "pending",
+		Entry:       formatTaskwarriorDate(item.Created),
+		Due:         formatTaskwarriorDate(item.Due),
+		Scheduled:   formatTaskwarriorDate(item.Start),
+		Tags:        item.Tags,
+	}
+	if item.Finished {
+		task.Status = "completed"
+		task.End = formatTaskwarriorDate(item.Updated)
+	}
+
+	switch item.Priority {
+	case 3:
+		task.Priority = "H"
+	case 1:
+		task.Priority = "L"
+	default:
+		task.Priority = "M"
+	}
+	return task
+}
+
+// Helper function to parse a Taskwarrior date, returns zero time if empty
+func parseTaskwarriorDate(d string) (time.Time, error) {
+	if d == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(taskwarriorDate, d)
+	if err != nil {
+		return time.Time{}, invalidInput("Invalid Taskwarrior date: %s", d)
+	}
+	return t.Local(), nil
+}
+
+// Helper function to format a date for Taskwarrior, empty if zero time
+func formatTaskwarriorDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(taskwarriorDate)
+}
+
+// Generates a random (version 4) UUID
+func newUUID() (string, error) {
+	b, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Function to show the current username and where the items are stored
+func whoami(settings Settings) {
+	fmt.Printf("%s%s%s\n", WHITE_C, settings.Username, RESET_C)
+	if profile := currentProfile(); profile != DefaultProfile {
+		fmt.Printf("%sUsing profile %s%s\n", GREY_C, profile, RESET_C)
+	}
+	switch settings.Backend {
+	case PostgresBackend:
+		fmt.Printf("%sItems stored in database %s on %s:%d%s\n", GREY_C, settings.Database.Name, settings.Database.Host, settings.Database.Port, RESET_C)
+	case SqliteBackend:
+		fmt.Printf("%sItems stored in the sqlite database %s/items.db%s\n", GREY_C, getDataDir(), RESET_C)
+	case GitBackend:
+		fmt.Printf("%sItems stored in the git repository %s/repo%s\n", GREY_C, getDataDir(), RESET_C)
+	default:
+		fmt.Printf("%sItems stored in %s/items.json%s\n", GREY_C, getDataDir(), RESET_C)
+	}
+}
+
+// Function to manage the current user
+func userCommand(store Store, settings *Settings) error {
+	usageInfo := "Usage: wtodo user rename <new username> | claim"
+	if len(os.Args) < 3 {
+		return invalidInput(usageInfo)
+	}
+
+	switch os.Args[2] {
+	case "rename":
+		if len(os.Args) != 4 {
+			return invalidInput(usageInfo)
+		}
+		return renameUser(store, settings, os.Args[3])
+	case "claim":
+		if len(os.Args) != 3 {
+			return invalidInput(usageInfo)
+		}
+		return claimUnowned(store)
+	default:
+		return invalidInput("Invalid user action: %s\n%s", os.Args[2], usageInfo)
+	}
+}
+
+// Changes the username, moving all items owned by the user to the new name
+func renameUser(store Store, settings *Settings, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t\n") || len(name) > 100 {
+		return invalidInput("Invalid username: %s\nUsernames can't be empty, have spaces or be longer than 100 characters", name)
+	}
+	if name == settings.Username {
+		return nil
+	}
+
+	err := store.RenameUser(name)
+	if err != nil {
+		return err
+	}
+
+	oldName := settings.Username
+	settings.Username = name
+	err = savePrefs(settings)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sRenamed %s to %s%s\n", LIGHT_GREEN_C, oldName, name, RESET_C)
+	return nil
+}
+
+// Gives the items added before items had owners to the current user
+// This is never done on its own, as the first user to upgrade would take everyone's old items
+func claimUnowned(store Store) error {
+	n, err := store.ClaimItems()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		fmt.Printf("%sThere are no items without an owner%s\n", GREY_C, RESET_C)
+		return nil
+	}
+	fmt.Printf("%sClaimed %d items without an owner%s\n", LIGHT_GREEN_C, n, RESET_C)
+	return nil
+}
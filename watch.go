@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A change to an item made by any user, sent to stores being watched
+type Change struct {
+	Table string `json:"table"`
+	Op    string `json:"op"`
+	Id    int    `json:"id"`
+	User  string `json:"user"`
+}
+
+// Function to show changes as they happen, either by re-rendering the list or as a feed
+func watch(store Store, filter ListFilter) error {
+	var feed bool
+	watchFlags := flag.NewFlagSet("watch", flag.ExitOnError)
+	watchFlags.BoolVar(&feed, "feed", false, "Print each change instead of re-rendering the list")
+	watchFlags.StringVar(&filter.Tag, "t", "", "Only show items with this tag")
+	watchFlags.StringVar(&filter.List, "list", "", "Only show items in this shared list")
+	watchFlags.BoolVar(&filter.Mine, "mine", false, "Only show items assigned to you, or your own items that aren't assigned")
+	watchFlags.Parse(os.Args[2:])
+
+	// Remember the names of items that can be seen, so deleted items can be shown in the feed
+	items, err := store.SelectAll(true)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, t := range items {
+		names[t.Id] = t.Name
+	}
+
+	var onChange func(Change)
+	if feed {
+		fmt.Printf("%sWatching for changes, press Ctrl+C to stop%s\n", GREY_C, RESET_C)
+		onChange = func(c Change) {
+			printChange(store, c, names)
+		}
+	} else {
+		onChange = func(c Change) {
+			fmt.Print("\033[H\033[2J")
+			if err := list(store, filter); err != nil {
+				fmt.Fprintf(os.Stderr, "%s%s%s\n", LIGHT_RED_C, err, RESET_C)
+			}
+			fmt.Printf("%sWatching for changes, press Ctrl+C to stop%s\n", DARK_GREY_C, RESET_C)
+		}
+		onChange(Change{})
+	}
+
+	err = store.Watch(onChange)
+	if err != nil {
+		return fmt.Errorf("Could not watch for changes: %w", err)
+	}
+	return nil
+}
+
+// Helper function to print one line of the change feed, skipping items the user can't see
+func printChange(store Store, c Change, names map[int]string) {
+	t, err := store.SelectItem(c.Id)
+	var notFound *NotFoundError
+	if err != nil && !errors.As(err, &notFound) {
+		fmt.Fprintf(os.Stderr, "%s%s%s\n", LIGHT_RED_C, err, RESET_C)
+		return
+	}
+	name, known := names[c.Id]
+	if t.Id == 0 && !known {
+		return
+	}
+
+	action := c.Op + "d"
+	switch {
+	case c.Table == "comment":
+		action = "commented on"
+	case c.Op == "insert":
+		action = "added"
+	case c.Op == "update" && t.Finished:
+		action = "finished"
+	}
+	if t.Id != 0 {
+		name = t.Name
+		names[t.Id] = t.Name
+	} else {
+		delete(names, c.Id)
+	}
+
+	user := c.User
+	if user == "" {
+		user = "someone"
+	}
+	fmt.Printf("%s%s%s %s%s%s %s %s%d. %s%s%s\n", DARK_GREY_C, time.Now().Format("3:04pm"), RESET_C, TITLE1_C, user, RESET_C, action, DARK_GREY_C, c.Id, WHITE_C, name, RESET_C)
+}
+
+// Listens for the notifications sent by the triggers made in createTables
+func (s *dbStore) Watch(onChange func(Change)) error {
+	if s.db.sqlite {
+		return s.pollSqlite(onChange)
+	}
+
+	listener := pq.NewListener(s.connStr, time.Second, time.Minute, nil)
+	defer listener.Close()
+	err := listener.Listen("wtodo_changes")
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification means the connection was lost and remade, so anything could have changed
+			var c Change
+			if n == nil || json.Unmarshal([]byte(n.Extra), &c) != nil {
+				c = Change{Table: "item", Op: "update"}
+			}
+			onChange(c)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// Polls the sqlite database for changes made by other wtodo commands
+// sqlite has no notifications, so the items are compared to find what changed
+func (s *dbStore) pollSqlite(onChange func(Change)) error {
+	// The data version only changes for writes from other connections, so keep using the same one
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var version, last int
+	err = conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&last)
+	var items []Item
+	if err == nil {
+		items, err = s.SelectAll(true)
+	}
+	for err == nil {
+		time.Sleep(time.Second)
+		err = conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&version)
+		if err != nil || version == last {
+			continue
+		}
+		last = version
+
+		old := items
+		items, err = s.SelectAll(true)
+		if err != nil {
+			break
+		}
+		for _, c := range diffFileData(fileData{Items: old}, fileData{Items: items}) {
+			onChange(c)
+		}
+	}
+	return err
+}
+
+// Polls the data file for changes made by other wtodo commands
+func (s *fileStore) Watch(onChange func(Change)) error {
+	info, err := os.Stat(s.path)
+	var modTime time.Time
+	if err == nil {
+		modTime = info.ModTime()
+	}
+
+	for {
+		time.Sleep(time.Second)
+		info, err := os.Stat(s.path)
+		if err != nil || !info.ModTime().After(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		// Reload the file and compare it to what was loaded before
+		// It might be read halfway through being written, so try again on the next change
+		old := s.data
+		reloaded, err := openFileStore(s.path, s.user)
+		if err != nil {
+			continue
+		}
+		*s = *reloaded
+		for _, c := range diffFileData(old, s.data) {
+			if c.User == "" {
+				c.User = s.user
+			}
+			onChange(c)
+		}
+	}
+}
+
+// Helper function to find the changes between two versions of the data file
+func diffFileData(old fileData, new fileData) []Change {
+	var changes []Change
+	oldItems := make(map[int]Item)
+	for _, it := range old.Items {
+		oldItems[it.Id] = it
+	}
+	for _, it := range new.Items {
+		prev, ok := oldItems[it.Id]
+		if !ok {
+			changes = append(changes, Change{Table: "item", Op: "insert", Id: it.Id})
+		} else if !itemsEqual(prev, it) {
+			changes = append(changes, Change{Table: "item", Op: "update", Id: it.Id})
+		}
+		delete(oldItems, it.Id)
+	}
+	for id := range oldItems {
+		changes = append(changes, Change{Table: "item", Op: "delete", Id: id})
+	}
+	for _, c := range new.Comments {
+		if c.Id > old.NextComment {
+			changes = append(changes, Change{Table: "comment", Op: "insert", Id: c.ItemId, User: c.Author})
+		}
+	}
+	return changes
+}
+
+// Helper function to check if two items have the same values
+func itemsEqual(a Item, b Item) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}